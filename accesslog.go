@@ -0,0 +1,311 @@
+package exporter
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultAccessFormat is the default access.format of php-fpm.
+const defaultAccessFormat = `%R - %u %t "%m %r" %s`
+
+// accessLogConfig configures how the access log of a pool is read.
+type accessLogConfig struct {
+	// Path is the access.log of the pool. The access log is not read if
+	// unset.
+	Path string `yaml:"path"`
+	// Format is the access.format of the pool. Request durations, memory
+	// and CPU are only exported if it includes %d, %M and %C.
+	Format string `yaml:"format"`
+}
+
+// accessField is a placeholder of an access.format, such as %{mili}d.
+type accessField struct {
+	verb byte
+	arg  string
+	// unit is the number of %d units in a second, or of bytes in a %M
+	// unit.
+	unit float64
+}
+
+// durationUnits and memoryUnits are the units php-fpm accepts for %d and
+// %M. durationUnits are by how many of them make a second, memoryUnits by
+// how many bytes they are.
+var (
+	durationUnits = map[string]float64{
+		"":             1,
+		"seconds":      1,
+		"mili":         1e3,
+		"milli":        1e3,
+		"miliseconds":  1e3,
+		"milliseconds": 1e3,
+		"micro":        1e6,
+		"microseconds": 1e6,
+	}
+	memoryUnits = map[string]float64{
+		"":          1,
+		"bytes":     1,
+		"kilo":      1 << 10,
+		"kilobytes": 1 << 10,
+		"mega":      1 << 20,
+		"megabytes": 1 << 20,
+	}
+)
+
+// accessLogParser parses the lines of an access log written with a given
+// access.format.
+type accessLogParser struct {
+	re     *regexp.Regexp
+	fields []accessField
+}
+
+// newAccessLogParser builds a parser for lines written with format, using
+// the placeholders documented for access.format.
+func newAccessLogParser(format string) (*accessLogParser, error) {
+	p := &accessLogParser{}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			pattern.WriteString(regexp.QuoteMeta(format[i : i+1]))
+			continue
+		}
+
+		i++
+		if i >= len(format) {
+			return nil, errors.New("access format ends with %")
+		}
+
+		var field accessField
+		if format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, errors.New("unterminated { in access format")
+			}
+			field.arg = format[i+1 : i+end]
+			i += end + 1
+			if i >= len(format) {
+				return nil, errors.New("access format ends after {}")
+			}
+		}
+		field.verb = format[i]
+
+		var sub string
+		switch field.verb {
+		case '%':
+			pattern.WriteString("%")
+			continue
+		case 'd', 'M':
+			units := durationUnits
+			if field.verb == 'M' {
+				units = memoryUnits
+			}
+			unit, ok := units[strings.ToLower(field.arg)]
+			if !ok {
+				return nil, errors.Errorf("unknown unit %q for %%%c in access format", field.arg, field.verb)
+			}
+			field.unit = unit
+			sub = `[0-9.]+`
+		case 'C':
+			sub = `[0-9.]+`
+		case 'l', 'p', 'P':
+			sub = `[0-9]+`
+		case 's':
+			sub = `[0-9]{3}`
+		case 'm':
+			sub = `[A-Za-z]+`
+		case 'Q':
+			sub = `\??`
+		case 'r', 'q':
+			// neither the path nor the query string contain spaces, and the
+			// path ends at the query string.
+			sub = `[^?\s]*`
+		case 'e', 'f', 'n', 'o', 'R', 't', 'T', 'u':
+			sub = `.*?`
+		default:
+			return nil, errors.Errorf("unknown placeholder %%%c in access format", field.verb)
+		}
+
+		pattern.WriteString("(" + sub + ")")
+		p.fields = append(p.fields, field)
+	}
+
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build access log parser")
+	}
+	p.re = re
+
+	return p, nil
+}
+
+// accessLogEntry is a request read from the access log.
+type accessLogEntry struct {
+	status string
+	method string
+	script string
+	uri    string
+	// duration, memory and cpu are only valid if the format includes them.
+	duration    float64
+	memory      float64
+	cpu         float64
+	hasDuration bool
+	hasMemory   bool
+	hasCPU      bool
+}
+
+// parse parses a line of the access log. It returns false if the line does
+// not match the format.
+func (p *accessLogParser) parse(line string) (*accessLogEntry, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	entry := &accessLogEntry{}
+	for i, field := range p.fields {
+		value := m[i+1]
+		switch field.verb {
+		case 's':
+			entry.status = value
+		case 'm':
+			entry.method = strings.ToUpper(value)
+		case 'f':
+			entry.script = value
+		case 'r':
+			entry.uri = value
+		case 'd':
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false
+			}
+			entry.duration, entry.hasDuration = v/field.unit, true
+		case 'M':
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false
+			}
+			entry.memory, entry.hasMemory = v*field.unit, true
+		case 'C':
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false
+			}
+			entry.cpu, entry.hasCPU = v/100, true
+		}
+	}
+
+	return entry, true
+}
+
+// accessLogMetrics are the request histograms of a target read from its
+// access log.
+type accessLogMetrics struct {
+	parser   *accessLogParser
+	duration *prometheus.HistogramVec
+	memory   *prometheus.HistogramVec
+	cpu      *prometheus.HistogramVec
+	unparsed prometheus.Counter
+	methods  *labelLimiter
+	scripts  *labelLimiter
+}
+
+var accessLogLabels = []string{"status", "method", "script"}
+
+func newAccessLogMetrics(target string, c accessLogConfig, methods *labelLimiter, scripts *labelLimiter) (*accessLogMetrics, error) {
+	format := c.Format
+	if format == "" {
+		format = defaultAccessFormat
+	}
+	parser, err := newAccessLogParser(format)
+	if err != nil {
+		return nil, err
+	}
+
+	constLabels := prometheus.Labels{"target": target}
+	return &accessLogMetrics{
+		parser: parser,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Name:        "access_request_duration_seconds",
+			Help:        "Duration of requests read from the access log",
+			Buckets:     prometheus.ExponentialBuckets(0.005, 2, 14),
+			ConstLabels: constLabels,
+		}, accessLogLabels),
+		memory: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Name:        "access_request_memory_bytes",
+			Help:        "Peak memory of requests read from the access log",
+			Buckets:     prometheus.ExponentialBuckets(1<<20, 2, 10),
+			ConstLabels: constLabels,
+		}, accessLogLabels),
+		cpu: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Name:        "access_request_cpu_ratio",
+			Help:        "CPU used by requests read from the access log, as a ratio of their duration",
+			Buckets:     []float64{0.05, 0.1, 0.25, 0.5, 0.75, 1, 1.5, 2},
+			ConstLabels: constLabels,
+		}, accessLogLabels),
+		unparsed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "access_log_unparsed_lines_total",
+			Help:        "Number of lines of the access log that did not match its format",
+			ConstLabels: constLabels,
+		}),
+		methods: methods,
+		scripts: scripts,
+	}, nil
+}
+
+func (m *accessLogMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.memory.Describe(ch)
+	m.cpu.Describe(ch)
+	m.unparsed.Describe(ch)
+}
+
+func (m *accessLogMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.memory.Collect(ch)
+	m.cpu.Collect(ch)
+	m.unparsed.Collect(ch)
+}
+
+// observe parses a line of the access log and observes the request.
+func (m *accessLogMetrics) observe(line string) {
+	entry, ok := m.parser.parse(line)
+	if !ok {
+		m.unparsed.Inc()
+		return
+	}
+
+	labels := []string{
+		entry.status,
+		m.methods.value(entry.method),
+		m.scripts.value(requestScript(entry.script, entry.uri)),
+	}
+	if entry.hasDuration {
+		m.duration.WithLabelValues(labels...).Observe(entry.duration)
+	}
+	if entry.hasMemory {
+		m.memory.WithLabelValues(labels...).Observe(entry.memory)
+	}
+	if entry.hasCPU {
+		m.cpu.WithLabelValues(labels...).Observe(entry.cpu)
+	}
+}
+
+// tailAccessLog follows the access log of a target until the context is
+// canceled.
+func (e *Exporter) tailAccessLog(ctx context.Context, t *target) {
+	newTailer(t.AccessLog.Path, e.logger.With(zap.String("target", t.Name))).run(ctx, t.accessLog.observe)
+}
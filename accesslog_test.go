@@ -0,0 +1,171 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestAccessLogParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		line     string
+		expected accessLogEntry
+	}{
+		{
+			name:     "default",
+			format:   defaultAccessFormat,
+			line:     `127.0.0.1 -  21/Oct/2019:10:20:30 +0000 "GET /index.php" 200`,
+			expected: accessLogEntry{status: "200", method: "GET", uri: "/index.php"},
+		},
+		{
+			name:   "query string",
+			format: `%R - %u %t "%m %r%Q%q" %s`,
+			line:   `10.0.0.1 - alice 21/Oct/2019:10:20:30 +0000 "POST /users/42?page=2&sort=name" 302`,
+			expected: accessLogEntry{
+				status: "302",
+				method: "POST",
+				uri:    "/users/42",
+			},
+		},
+		{
+			name:   "timings",
+			format: `%R - %u %t "%m %r%Q%q" %s %f %{mili}d %{kilo}M %C%%`,
+			line:   `127.0.0.1 -  21/Oct/2019:10:20:30 +0000 "GET /index.php?id=3" 200 /var/www/index.php 123.456 2048 45.50%`,
+			expected: accessLogEntry{
+				status:      "200",
+				method:      "GET",
+				script:      "/var/www/index.php",
+				uri:         "/index.php",
+				duration:    0.123456,
+				memory:      2048 * 1024,
+				cpu:         0.455,
+				hasDuration: true,
+				hasMemory:   true,
+				hasCPU:      true,
+			},
+		},
+		{
+			name:   "other units",
+			format: `%{%Y-%m-%dT%H:%M:%S%z}t %n %p "%m %r" %s %{micro}d %{mega}M %{total}C`,
+			line:   `2019-10-21T10:20:30+0000 www 12345 "get /api.php" 500 2500000.000 64 198.00`,
+			expected: accessLogEntry{
+				status:      "500",
+				method:      "GET",
+				uri:         "/api.php",
+				duration:    2.5,
+				memory:      64 << 20,
+				cpu:         1.98,
+				hasDuration: true,
+				hasMemory:   true,
+				hasCPU:      true,
+			},
+		},
+		{
+			name:   "long unit names",
+			format: `"%m %r" %s %{milliseconds}d %{kilobytes}M`,
+			line:   `"GET /index.php" 200 250.000 512`,
+			expected: accessLogEntry{
+				status:      "200",
+				method:      "GET",
+				uri:         "/index.php",
+				duration:    0.25,
+				memory:      512 << 10,
+				hasDuration: true,
+				hasMemory:   true,
+			},
+		},
+		{
+			name:   "unit names in any case",
+			format: `"%m %r" %s %{MicroSeconds}d %{MEGABYTES}M`,
+			line:   `"GET /index.php" 200 1500 2`,
+			expected: accessLogEntry{
+				status:      "200",
+				method:      "GET",
+				uri:         "/index.php",
+				duration:    0.0015,
+				memory:      2 << 20,
+				hasDuration: true,
+				hasMemory:   true,
+			},
+		},
+		{
+			name:   "explicit seconds and bytes",
+			format: `"%m %r" %s %{seconds}d %{bytes}M %{miliseconds}d %{Milli}d`,
+			line:   `"GET /index.php" 200 0.5 1024 500 500`,
+			expected: accessLogEntry{
+				status:      "200",
+				method:      "GET",
+				uri:         "/index.php",
+				duration:    0.5,
+				memory:      1024,
+				hasDuration: true,
+				hasMemory:   true,
+			},
+		},
+		{
+			name:   "seconds and bytes",
+			format: `%m %r %s %d %M %l %{REQUEST_SCHEME}e %{Content-Type}o`,
+			line:   `HEAD /health 204 0.015 524288 0 https text/html; charset=UTF-8`,
+			expected: accessLogEntry{
+				status:      "204",
+				method:      "HEAD",
+				uri:         "/health",
+				duration:    0.015,
+				memory:      524288,
+				hasDuration: true,
+				hasMemory:   true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := newAccessLogParser(test.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entry, ok := p.parse(test.line)
+			if !ok {
+				t.Fatalf("failed to parse %q", test.line)
+			}
+			if *entry != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, *entry)
+			}
+		})
+	}
+}
+
+func TestAccessLogParserMismatch(t *testing.T) {
+	p, err := newAccessLogParser(`"%m %r" %s %{mili}d`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range []string{
+		"",
+		`"GET /index.php" 200`,
+		`"GET /index.php" 2000 1.0`,
+		`"GET /index.php" 200 fast`,
+	} {
+		if entry, ok := p.parse(line); ok {
+			t.Errorf("expected %q not to match, got %+v", line, entry)
+		}
+	}
+}
+
+func TestAccessLogParserInvalidFormat(t *testing.T) {
+	for _, format := range []string{
+		"%Z",
+		"%s %",
+		"%{mili",
+		"%{mili}",
+		"%{hours}d",
+		"%{giga}M",
+		"%{kilo}d",
+	} {
+		if _, err := newAccessLogParser(format); err == nil {
+			t.Errorf("expected format %q to be rejected", format)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package exporter
+
+import (
+	"github.com/pkg/errors"
+)
+
+// errBacklogUnsupported is returned when socket backlogs cannot be read on
+// this platform.
+var errBacklogUnsupported = errors.New("reading socket backlogs is only supported on linux")
+
+// socketBacklog is the accept queue of a listening socket.
+type socketBacklog struct {
+	// current is the number of connections waiting to be accepted.
+	current uint64
+	// max is the size of the queue, the listen.backlog of the pool. Zero
+	// means unknown.
+	max uint64
+}
+
+// socketBacklog reads the backlog of the socket php-fpm listens on for a
+// fastcgi target straight from the kernel, so it is available even when
+// the status page does not answer.
+func (e *Exporter) socketBacklog(t *target) (*socketBacklog, error) {
+	switch t.url.Scheme {
+	case "tcp":
+		return readTCPBacklog(e.procPath, t.url.Host)
+	case "unix":
+		path, _ := splitUnixPath(t.url.Path)
+		return readUnixBacklog(e.procPath, path)
+	}
+	return nil, errors.Errorf("no socket for %s target", t.url.Scheme)
+}
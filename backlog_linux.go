@@ -0,0 +1,294 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+// tcpListen is the TCP_LISTEN socket state.
+const tcpListen = 10
+
+// readTCPBacklog reads the backlog of the TCP socket listening on address.
+// The current backlog is read from /proc/net/tcp and /proc/net/tcp6. They
+// do not include the size of the queue, so that is asked for using
+// sock_diag, if permitted.
+func readTCPBacklog(procPath string, address string) (*socketBacklog, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid address %s", address)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid port in %s", address)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ips, err = net.LookupIP(host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve %s", host)
+		}
+	}
+
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open procfs")
+	}
+
+	var sockets procfs.NetTCP
+	for _, read := range []func() (procfs.NetTCP, error){fs.NetTCP, fs.NetTCP6} {
+		s, err := read()
+		if err != nil {
+			// tcp6 is missing if IPv6 is disabled.
+			continue
+		}
+		sockets = append(sockets, s...)
+	}
+
+	var found bool
+	b := &socketBacklog{}
+	for _, s := range sockets {
+		if s.St != tcpListen || s.LocalPort != port || !listensOn(s.LocalAddr, ips) {
+			continue
+		}
+		found = true
+		// for listening sockets, the receive queue is the accept queue.
+		b.current += s.RxQueue
+	}
+	if !found {
+		return nil, errors.Errorf("no socket listening on %s", address)
+	}
+
+	if max, err := inetDiagMaxBacklog(uint16(port), ips); err == nil {
+		b.max = max
+	}
+
+	return b, nil
+}
+
+// listensOn returns whether a socket bound to addr accepts connections to
+// any of ips.
+func listensOn(addr net.IP, ips []net.IP) bool {
+	if addr.IsUnspecified() {
+		return true
+	}
+	for _, ip := range ips {
+		if addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// readUnixBacklog reads the backlog of the unix socket listening on path.
+// The socket is found in /proc/net/unix, which does not include queue
+// lengths, so they are asked for using sock_diag.
+func readUnixBacklog(procPath string, path string) (*socketBacklog, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open procfs")
+	}
+
+	sockets, err := fs.NetUNIX()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read unix sockets")
+	}
+
+	// see netUnixFlagListen in procfs.
+	const unixFlagListen = 1 << 16
+
+	var inode uint64
+	for _, s := range sockets.Rows {
+		if s.Path == path && s.Flags&unixFlagListen != 0 {
+			inode = s.Inode
+			break
+		}
+	}
+	if inode == 0 {
+		return nil, errors.Errorf("no socket listening on %s", path)
+	}
+
+	return unixDiagBacklog(uint32(inode))
+}
+
+// sock_diag constants and structures, from linux/sock_diag.h,
+// linux/inet_diag.h and linux/unix_diag.h.
+const (
+	sockDiagByFamily = 20
+
+	sizeofInetDiagReqV2 = 56
+	sizeofInetDiagMsg   = 72
+	sizeofUnixDiagReq   = 24
+	sizeofUnixDiagMsg   = 16
+
+	udiagShowRQLen = 0x10
+	unixDiagRQLen  = 4
+)
+
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// inetDiagMaxBacklog returns the largest accept queue size of the TCP
+// sockets listening on port for any of ips.
+func inetDiagMaxBacklog(port uint16, ips []net.IP) (uint64, error) {
+	var max uint64
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		req := make([]byte, sizeofInetDiagReqV2)
+		req[0] = family
+		req[1] = unix.IPPROTO_TCP
+		nativeEndian.PutUint32(req[4:], 1<<tcpListen)
+
+		err := sockDiag(req, func(msg []byte) {
+			l, ok := parseInetDiagMsg(msg)
+			if !ok || l.port != port || !listensOn(l.addr, ips) {
+				return
+			}
+			if l.maxBacklog > max {
+				max = l.maxBacklog
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return max, nil
+}
+
+// inetListener is a listening TCP socket reported by inet_diag.
+type inetListener struct {
+	port       uint16
+	addr       net.IP
+	maxBacklog uint64
+}
+
+// parseInetDiagMsg decodes a struct inet_diag_msg. The socket id starts at
+// byte 4 with the source and destination ports, followed by the source
+// address at byte 8.
+func parseInetDiagMsg(msg []byte) (*inetListener, bool) {
+	if len(msg) < sizeofInetDiagMsg {
+		return nil, false
+	}
+
+	// ports and addresses are in network byte order.
+	l := &inetListener{
+		port: binary.BigEndian.Uint16(msg[4:]),
+		// for listening sockets, the write queue is the accept queue size.
+		maxBacklog: uint64(nativeEndian.Uint32(msg[60:])),
+	}
+	switch msg[0] {
+	case unix.AF_INET:
+		l.addr = net.IP(append([]byte(nil), msg[8:12]...))
+	case unix.AF_INET6:
+		l.addr = net.IP(append([]byte(nil), msg[8:24]...))
+	default:
+		return nil, false
+	}
+	return l, true
+}
+
+// unixDiagBacklog returns the backlog of the listening unix socket with the
+// given inode.
+func unixDiagBacklog(inode uint32) (*socketBacklog, error) {
+	req := make([]byte, sizeofUnixDiagReq)
+	req[0] = unix.AF_UNIX
+	nativeEndian.PutUint32(req[4:], 1<<tcpListen)
+	nativeEndian.PutUint32(req[12:], udiagShowRQLen)
+
+	var b *socketBacklog
+	err := sockDiag(req, func(msg []byte) {
+		if len(msg) < sizeofUnixDiagMsg || nativeEndian.Uint32(msg[4:]) != inode {
+			return
+		}
+		attrs := msg[sizeofUnixDiagMsg:]
+		for len(attrs) >= unix.SizeofRtAttr {
+			length := int(nativeEndian.Uint16(attrs[0:]))
+			kind := nativeEndian.Uint16(attrs[2:])
+			if length < unix.SizeofRtAttr || length > len(attrs) {
+				return
+			}
+			if kind == unixDiagRQLen && length >= unix.SizeofRtAttr+8 {
+				// for listening sockets, the receive queue is the accept
+				// queue and the write queue is its size.
+				b = &socketBacklog{
+					current: uint64(nativeEndian.Uint32(attrs[unix.SizeofRtAttr:])),
+					max:     uint64(nativeEndian.Uint32(attrs[unix.SizeofRtAttr+4:])),
+				}
+			}
+			aligned := (length + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+			if aligned > len(attrs) {
+				return
+			}
+			attrs = attrs[aligned:]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, errors.Errorf("socket %d not found by sock_diag", inode)
+	}
+	return b, nil
+}
+
+// sockDiag sends a sock_diag dump request and calls fn with the body of
+// each message in the response.
+func sockDiag(req []byte, fn func(msg []byte)) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return errors.Wrap(err, "failed to open sock_diag socket")
+	}
+	defer unix.Close(fd)
+
+	msg := make([]byte, unix.NLMSG_HDRLEN+len(req))
+	nativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	nativeEndian.PutUint16(msg[4:], sockDiagByFamily)
+	nativeEndian.PutUint16(msg[6:], unix.NLM_F_REQUEST|unix.NLM_F_DUMP)
+	nativeEndian.PutUint32(msg[8:], 1)
+	copy(msg[unix.NLMSG_HDRLEN:], req)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return errors.Wrap(err, "failed to send sock_diag request")
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return errors.Wrap(err, "failed to read sock_diag response")
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return errors.Wrap(err, "failed to parse sock_diag response")
+		}
+
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case unix.NLMSG_DONE:
+				return nil
+			case unix.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := int32(nativeEndian.Uint32(m.Data)); errno != 0 {
+						return errors.Wrap(syscall.Errno(-errno), "sock_diag request failed")
+					}
+				}
+				return nil
+			}
+			fn(m.Data)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// inet_diag messages captured from a dump of listening sockets on x86_64,
+// for 127.0.0.1:43193 and [::1]:41839 with a backlog of 4096.
+const (
+	inetDiagMsg4 = "020a0000a8b900007f0000010000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000010000000000000b9fc0000050008000000000008000f00000000000c00150001000000000000000600160052000000"
+	inetDiagMsg6 = "0a0a0000a36f0000000000000000000000000000000000010000000000000000000000000000000000000000110000000000000000000000000000000010000000000000bafc0000050008000000000005000b000100000008000f00000000000c00150001000000000000000600160012000000"
+)
+
+func TestParseInetDiagMsg(t *testing.T) {
+	if nativeEndian != binary.LittleEndian {
+		t.Skip("messages were captured on a little endian host")
+	}
+
+	tests := []struct {
+		name     string
+		msg      string
+		port     uint16
+		addr     net.IP
+		backlog  uint64
+		listenOn []net.IP
+	}{
+		{"ipv4", inetDiagMsg4, 43193, net.ParseIP("127.0.0.1"), 4096, []net.IP{net.ParseIP("127.0.0.1")}},
+		{"ipv6", inetDiagMsg6, 41839, net.ParseIP("::1"), 4096, []net.IP{net.ParseIP("::1")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := hex.DecodeString(test.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l, ok := parseInetDiagMsg(msg)
+			if !ok {
+				t.Fatal("failed to parse message")
+			}
+			if l.port != test.port {
+				t.Errorf("expected port %d, got %d", test.port, l.port)
+			}
+			if !l.addr.Equal(test.addr) {
+				t.Errorf("expected address %s, got %s", test.addr, l.addr)
+			}
+			if l.maxBacklog != test.backlog {
+				t.Errorf("expected backlog %d, got %d", test.backlog, l.maxBacklog)
+			}
+			if !listensOn(l.addr, test.listenOn) {
+				t.Errorf("expected %s to listen on %v", l.addr, test.listenOn)
+			}
+			if listensOn(l.addr, []net.IP{net.ParseIP("10.0.0.1")}) {
+				t.Errorf("expected %s not to listen on 10.0.0.1", l.addr)
+			}
+		})
+	}
+
+	if _, ok := parseInetDiagMsg(make([]byte, sizeofInetDiagMsg-1)); ok {
+		t.Error("expected a short message to be rejected")
+	}
+}
+
+func TestInetDiagMaxBacklog(t *testing.T) {
+	data, err := ioutil.ReadFile("/proc/sys/net/core/somaxconn")
+	if err != nil {
+		t.Skip(err)
+	}
+	somaxconn, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+
+	max, err := inetDiagMaxBacklog(port, []net.IP{net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("sock_diag is not available: %v", err)
+	}
+	// go listens with the largest backlog allowed, up to 65535.
+	if somaxconn > 65535 {
+		somaxconn = 65535
+	}
+	if max != somaxconn {
+		t.Errorf("expected backlog %d, got %d", somaxconn, max)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package exporter
+
+func readTCPBacklog(procPath string, address string) (*socketBacklog, error) {
+	return nil, errBacklogUnsupported
+}
+
+func readUnixBacklog(procPath string, path string) (*socketBacklog, error) {
+	return nil, errBacklogUnsupported
+}
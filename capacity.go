@@ -0,0 +1,220 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/procfs"
+)
+
+// readMemoryLimit returns the memory available to a process, the smaller of
+// the memory of the host and the memory limits of its cgroup and the
+// cgroup's ancestors. Both cgroup v1 and v2 are supported.
+func readMemoryLimit(procPath string, sysPath string, pid int) (float64, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open procfs")
+	}
+	meminfo, err := fs.Meminfo()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read meminfo")
+	}
+	if meminfo.MemTotal == nil {
+		return 0, errors.New("no MemTotal in meminfo")
+	}
+	// meminfo is in kB.
+	limit := float64(*meminfo.MemTotal) * 1024
+
+	cgroup, err := readMemoryCgroup(procPath, sysPath, pid)
+	if err != nil {
+		return 0, err
+	}
+	if cgroup == nil {
+		return limit, nil
+	}
+
+	// the cgroup path is relative to the root of the hierarchy, which in a
+	// container may not be where it is mounted, so every directory up to
+	// the mount is checked.
+	for dir := cgroup.path; ; dir = path.Dir(dir) {
+		filename := filepath.Join(cgroup.mount, dir, cgroup.limitFile)
+		if l, ok := readCgroupLimit(filename); ok && l < limit {
+			limit = l
+		}
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	return limit, nil
+}
+
+// memoryCgroup is the memory cgroup of a process.
+type memoryCgroup struct {
+	// path is the cgroup path relative to the root of the hierarchy.
+	path string
+	// mount is where the hierarchy is mounted.
+	mount string
+	// limitFile is the name of the file holding the memory limit.
+	limitFile string
+}
+
+// readMemoryCgroup returns the memory cgroup of a process, or nil if it is
+// not in one.
+func readMemoryCgroup(procPath string, sysPath string, pid int) (*memoryCgroup, error) {
+	f, err := os.Open(filepath.Join(procPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cgroups")
+	}
+	defer f.Close()
+
+	root := filepath.Join(sysPath, "fs", "cgroup")
+
+	unified := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// each line is hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return &memoryCgroup{
+					path:      parts[2],
+					mount:     filepath.Join(root, "memory"),
+					limitFile: "memory.limit_in_bytes",
+				}, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read cgroups")
+	}
+
+	if unified == "" {
+		return nil, nil
+	}
+
+	// with both versions mounted, the v2 hierarchy is below unified.
+	if _, err := os.Stat(filepath.Join(root, "unified")); err == nil {
+		root = filepath.Join(root, "unified")
+	}
+	return &memoryCgroup{
+		path:      unified,
+		mount:     root,
+		limitFile: "memory.max",
+	}, nil
+}
+
+// readCgroupLimit reads a cgroup memory limit file. It returns false if the
+// file cannot be read or there is no limit.
+func readCgroupLimit(filename string) (float64, bool) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, false
+	}
+	l, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(l), true
+}
+
+// recommendedMaxChildren estimates how many workers fit in the memory
+// available to the pool, keeping headroom as a fraction of it free.
+//
+// Memory shared between workers is paid for once, so each additional
+// worker is assumed to need as much private memory as the largest current
+// worker. It returns false if there are no workers or their memory or the
+// memory limit could not be read.
+func (p *poolProcesses) recommendedMaxChildren(headroom float64) (int64, bool) {
+	w := p.workers
+	if p.memoryLimitErr != nil || w.processes == 0 || w.smapsRead < w.processes || w.maxPrivate == 0 || p.master.smapsRead == 0 {
+		return 0, false
+	}
+
+	shared := w.pss - w.private
+	budget := p.memoryLimit*(1-headroom) - p.master.pss - shared
+	if budget <= 0 {
+		return 0, true
+	}
+
+	return int64(math.Floor(budget / w.maxPrivate)), true
+}
+
+// CapacityReport writes a memory based estimate of the pm.max_children of
+// each target with a pid or pid file set. Targets whose processes cannot be
+// read are reported with the error.
+func (e *Exporter) CapacityReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tWORKERS\tAVG PSS\tMAX PRIVATE\tMASTER PSS\tMEMORY LIMIT\tMAX CHILDREN\tRECOMMENDED")
+
+	for _, t := range e.targets {
+		if !t.processes() {
+			continue
+		}
+
+		p, err := e.poolProcesses(t)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\terror: %s\n", t.Name, err)
+			continue
+		}
+
+		current := "-"
+		if limits, err := t.limits(t.PoolName); err == nil && limits.MaxChildren > 0 {
+			current = strconv.FormatInt(limits.MaxChildren, 10)
+		}
+
+		recommended := "-"
+		if n, ok := p.recommendedMaxChildren(e.capacityHeadroom); ok {
+			recommended = strconv.FormatInt(n, 10)
+		}
+
+		memoryLimit := "-"
+		if p.memoryLimitErr == nil {
+			memoryLimit = formatBytes(p.memoryLimit)
+		}
+
+		avgPss := 0.0
+		if p.workers.smapsRead > 0 {
+			avgPss = p.workers.pss / float64(p.workers.smapsRead)
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.Name,
+			p.workers.processes,
+			formatBytes(avgPss),
+			formatBytes(p.workers.maxPrivate),
+			formatBytes(p.master.pss),
+			memoryLimit,
+			current,
+			recommended,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// formatBytes formats a size in mebibytes.
+func formatBytes(b float64) string {
+	return fmt.Sprintf("%.1fMiB", b/(1<<20))
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"go.uber.org/zap"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
@@ -13,29 +19,101 @@ func main() {
 		endpoint        = kingpin.Flag("endpoint", "url for php-fpm status").Default("http://127.0.0.1:9000/status").Envar("ENDPOINT_URL").String()
 		fcgiEndpoint    = kingpin.Flag("fastcgi", "fastcgi url. If this is set, fastcgi will be used instead of HTTP").Envar("FASTCGI_URL").String()
 		metricsEndpoint = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics. Cannot be /").Default("/metrics").Envar("TELEMETRY_PATH").String()
+		targets         = kingpin.Flag("target", "php-fpm pool to scrape in the form name=url. May be repeated. If set, --endpoint and --fastcgi are ignored").Strings()
+		probeAllow      = kingpin.Flag("probe.allow", "regular expression a target passed to /probe must match. May be repeated. If unset, all probes are rejected").Strings()
+		errorLogs       = kingpin.Flag("error-log", "php-fpm error_log to count events from. May be repeated").Strings()
+		configFile      = kingpin.Flag("config.file", "configuration file listing php-fpm pools to scrape").Envar("CONFIG_FILE").String()
+		dialTimeout     = kingpin.Flag("timeout.dial", "default timeout for connecting to php-fpm").Default("1s").Envar("DIAL_TIMEOUT").Duration()
+		readTimeout     = kingpin.Flag("timeout.read", "default timeout for reading the status page once connected").Default("5s").Envar("READ_TIMEOUT").Duration()
+		scrapeTimeout   = kingpin.Flag("timeout.scrape", "default timeout for a whole scrape of a pool. A shorter timeout requested by Prometheus takes precedence").Default("10s").Envar("SCRAPE_TIMEOUT").Duration()
+		scrapeInterval  = kingpin.Flag("scrape.interval", "default interval for scraping pools in the background and serving metrics from the latest snapshot. 0 scrapes on each request").Default("0s").Envar("SCRAPE_INTERVAL").Duration()
+		maxStaleness    = kingpin.Flag("scrape.max-staleness", "default age after which a background snapshot is reported as down. 0 means three scrape intervals").Default("0s").Envar("MAX_STALENESS").Duration()
+		minInterval     = kingpin.Flag("scrape.min-interval", "default shortest time between two status requests to a pool. Scrapes within it are served the previous result").Default("1s").Envar("MIN_INTERVAL").Duration()
+		sysfsPath       = kingpin.Flag("path.sysfs", "mount point of the sys filesystem used to read cgroup memory limits").Default("/sys").Envar("SYSFS_PATH").String()
+		headroom        = kingpin.Flag("capacity.headroom", "fraction of the memory available to a pool kept free when recommending pm.max_children").Default("0.1").Envar("CAPACITY_HEADROOM").Float64()
+		maxLabelValues  = kingpin.Flag("labels.max-values", "largest number of distinct values of a label taken from logs, such as the script of a slow request. Further values are replaced by other").Default("100").Envar("MAX_LABEL_VALUES").Int()
+		slowlogWindow   = kingpin.Flag("slowlog.window", "how long slowlog stack traces are kept for /slowlog/stacks").Default("10m").Envar("SLOWLOG_WINDOW").Duration()
+		procfsPath      = kingpin.Flag("path.procfs", "mount point of the proc filesystem used to read socket backlogs and pool processes").Default("/proc").Envar("PROCFS_PATH").String()
+		webConfigFile   = kingpin.Flag("web.config.file", "configuration file for TLS and basic authentication").Envar("WEB_CONFIG_FILE").String()
+		runtimeMetrics  = kingpin.Flag("web.runtime-metrics", "export the Go runtime and process metrics of the exporter itself").Default("true").Envar("RUNTIME_METRICS").Bool()
+		full            = kingpin.Flag("full", "request the full status page and export metrics for each worker").Envar("FULL_STATUS").Bool()
+
+		serveCommand    = kingpin.Command("serve", "serve metrics").Default()
+		capacityCommand = kingpin.Command("capacity", "print a memory based estimate of pm.max_children for pools with a pid or pid_file set")
 	)
 
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	logger, err := exporter.NewLogger()
 	if err != nil {
 		panic(err)
 	}
 
-	e, err := exporter.New(
+	options := []exporter.OptionsFunc{
 		exporter.SetAddress(*addr),
 		exporter.SetEndpoint(*endpoint),
 		exporter.SetFastcgi(*fcgiEndpoint),
 		exporter.SetLogger(logger),
 		exporter.SetMetricsEndpoint(*metricsEndpoint),
-	)
+		exporter.SetFull(*full),
+		exporter.SetProbeAllow(*probeAllow),
+		exporter.SetConfigFile(*configFile),
+		exporter.SetDialTimeout(*dialTimeout),
+		exporter.SetReadTimeout(*readTimeout),
+		exporter.SetScrapeTimeout(*scrapeTimeout),
+		exporter.SetScrapeInterval(*scrapeInterval),
+		exporter.SetMaxStaleness(*maxStaleness),
+		exporter.SetMinInterval(*minInterval),
+		exporter.SetProcfsPath(*procfsPath),
+		exporter.SetSysfsPath(*sysfsPath),
+		exporter.SetCapacityHeadroom(*headroom),
+		exporter.SetMaxLabelValues(*maxLabelValues),
+		exporter.SetSlowlogWindow(*slowlogWindow),
+		exporter.SetRuntimeMetrics(*runtimeMetrics),
+		exporter.SetWebConfigFile(*webConfigFile),
+	}
+
+	for _, f := range *errorLogs {
+		options = append(options, exporter.AddErrorLog(f))
+	}
+
+	for _, t := range *targets {
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 {
+			logger.Fatal("target must be in the form name=url", zap.String("target", t))
+		}
+		options = append(options, exporter.AddTarget(parts[0], parts[1]))
+	}
+
+	e, err := exporter.New(options...)
 
 	if err != nil {
 		logger.Fatal("failed to create exporter", zap.Error(err))
 	}
 
-	if err := e.Run(); err != nil {
+	switch command {
+	case serveCommand.FullCommand():
+		serve(e, logger)
+	case capacityCommand.FullCommand():
+		if err := e.CapacityReport(os.Stdout); err != nil {
+			logger.Fatal("failed to report capacity", zap.Error(err))
+		}
+	}
+}
+
+func serve(e *exporter.Exporter, logger *zap.Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-stopChan
+		cancel()
+	}()
+
+	if err := e.Run(ctx); err != nil {
 		logger.Fatal("failed to run exporter", zap.Error(err))
 	}
 }
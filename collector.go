@@ -1,11 +1,15 @@
 package exporter
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,107 +17,337 @@ import (
 	"go.uber.org/zap"
 )
 
-var (
-	statusLineRegexp = regexp.MustCompile(`(?m)^(.*):\s+(.*)$`)
-)
-
 type collector struct {
 	exporter           *Exporter
+	targets            []*target
+	timeout            time.Duration
+	counters           []prometheus.Collector
 	up                 *prometheus.Desc
+	info               *prometheus.Desc
+	startTime          *prometheus.Desc
 	acceptedConn       *prometheus.Desc
 	listenQueue        *prometheus.Desc
 	maxListenQueue     *prometheus.Desc
 	listenQueueLength  *prometheus.Desc
 	phpProcesses       *prometheus.Desc
+	totalProcesses     *prometheus.Desc
+	maxChildren        *prometheus.Desc
+	startServers       *prometheus.Desc
+	minSpareServers    *prometheus.Desc
+	maxSpareServers    *prometheus.Desc
 	maxActiveProcesses *prometheus.Desc
 	maxChildrenReached *prometheus.Desc
 	slowRequests       *prometheus.Desc
+	utilization        *prometheus.Desc
+	saturated          *prometheus.Desc
+	queueWait          *prometheus.Desc
 	scrapeFailures     *prometheus.Desc
-	failureCount       int
+	snapshotAge        *prometheus.Desc
+	pingUp             *prometheus.Desc
+	socketBacklog      *prometheus.Desc
+	socketBacklogMax   *prometheus.Desc
+	poolMemory         *prometheus.Desc
+	poolCPU            *prometheus.Desc
+	poolFDs            *prometheus.Desc
+	poolThreads        *prometheus.Desc
+	poolCtxSwitches    *prometheus.Desc
+	masterUptime       *prometheus.Desc
+	poolPss            *prometheus.Desc
+	poolPrivate        *prometheus.Desc
+	memoryLimit        *prometheus.Desc
+	recommendedMax     *prometheus.Desc
+	processRequests    *prometheus.Desc
+	processStartTime   *prometheus.Desc
+	processDuration    *prometheus.Desc
+	processContentLen  *prometheus.Desc
+	processLastCPU     *prometheus.Desc
+	processLastMemory  *prometheus.Desc
 }
 
 const metricsNamespace = "phpfpm"
 
+var processLabels = []string{"pid", "state"}
+
+var roleLabels = []string{"role"}
+
+// newFuncMetric creates a description for a per-target metric. The target
+// label is always the first label.
 func newFuncMetric(metricName string, docString string, labels []string) *prometheus.Desc {
 	return prometheus.NewDesc(
 		prometheus.BuildFQName(metricsNamespace, "", metricName),
-		docString, labels, nil,
+		docString, append([]string{"target"}, labels...), nil,
 	)
 }
 
-func (e *Exporter) newCollector() *collector {
+func (e *Exporter) newCollector(targets []*target) *collector {
 	return &collector{
 		exporter:           e,
+		targets:            targets,
 		up:                 newFuncMetric("up", "able to contact php-fpm", nil),
+		info:               newFuncMetric("info", "Information about the php-fpm pool", []string{"pool", "process_manager"}),
+		startTime:          newFuncMetric("start_time_seconds", "Unix time when php-fpm was started", nil),
 		acceptedConn:       newFuncMetric("accepted_connections_total", "Total number of accepted connections", nil),
 		listenQueue:        newFuncMetric("listen_queue_connections", "Number of connections that have been initiated but not yet accepted", nil),
 		maxListenQueue:     newFuncMetric("listen_queue_max_connections", "Max number of connections the listen queue has reached since FPM start", nil),
 		listenQueueLength:  newFuncMetric("listen_queue_length_connections", "The length of the socket queue, dictating maximum number of pending connections", nil),
 		phpProcesses:       newFuncMetric("processes_total", "process count", []string{"state"}),
+		totalProcesses:     newFuncMetric("total_processes", "Number of idle and active processes", nil),
+		maxChildren:        newFuncMetric("pm_max_children", "Configured pm.max_children of the pool", nil),
+		startServers:       newFuncMetric("pm_start_servers", "Configured pm.start_servers of the pool", nil),
+		minSpareServers:    newFuncMetric("pm_min_spare_servers", "Configured pm.min_spare_servers of the pool", nil),
+		maxSpareServers:    newFuncMetric("pm_max_spare_servers", "Configured pm.max_spare_servers of the pool", nil),
 		maxActiveProcesses: newFuncMetric("active_max_processes", "Maximum active process count", nil),
 		maxChildrenReached: newFuncMetric("max_children_reached_total", "Number of times the process limit has been reached", nil),
 		slowRequests:       newFuncMetric("slow_requests_total", "Number of requests that exceed request_slowlog_timeout", nil),
-		scrapeFailures:     newFuncMetric("scrape_failures_total", "Number of errors while scraping php_fpm", nil),
+		utilization:        newFuncMetric("process_utilization_ratio", "Ratio of active to total processes", nil),
+		saturated:          newFuncMetric("saturated", "Whether connections are waiting in the listen queue or the process limit was reached since the previous scrape", nil),
+		queueWait:          newFuncMetric("listen_queue_wait_seconds", "Estimated time connections wait in the listen queue, from the listen queue length and the accepted connection rate between scrapes", nil),
+		snapshotAge:        newFuncMetric("snapshot_age_seconds", "Age of the background scrape that metrics are served from", nil),
+		pingUp:             newFuncMetric("ping_up", "Whether php-fpm answered the ping check with the expected response", nil),
+		socketBacklog:      newFuncMetric("socket_backlog", "Number of connections waiting to be accepted on the listening socket, read from the kernel", nil),
+		socketBacklogMax:   newFuncMetric("socket_backlog_max", "Size of the accept queue of the listening socket, read from the kernel", nil),
+		poolMemory:         newFuncMetric("pool_resident_memory_bytes", "Resident memory of the pool's master or its workers, read from procfs", roleLabels),
+		poolCPU:            newFuncMetric("pool_cpu_seconds_total", "CPU time of the pool's master or its workers, including workers that have exited, read from procfs", roleLabels),
+		poolFDs:            newFuncMetric("pool_open_fds", "Open file descriptors of the pool's master or its workers, read from procfs", roleLabels),
+		poolThreads:        newFuncMetric("pool_threads", "Threads of the pool's master or its workers, read from procfs", roleLabels),
+		poolCtxSwitches:    newFuncMetric("pool_context_switches", "Context switches of the running master or workers of the pool, read from procfs", roleLabels),
+		masterUptime:       newFuncMetric("master_uptime_seconds", "Time since the pool's master was started, read from procfs", nil),
+		poolPss:            newFuncMetric("pool_pss_bytes", "Proportional set size of the pool's master or its workers, read from smaps_rollup", roleLabels),
+		poolPrivate:        newFuncMetric("pool_private_memory_bytes", "Private memory of the pool's master or its workers, read from smaps_rollup", roleLabels),
+		memoryLimit:        newFuncMetric("memory_limit_bytes", "Memory available to the pool, the smaller of its cgroup memory limit and the memory of the host", nil),
+		recommendedMax:     newFuncMetric("recommended_max_children", "Estimated pm.max_children that fits in the memory available to the pool, keeping the configured headroom free", nil),
+		scrapeFailures:     newFuncMetric("scrape_failures_total", "Number of errors while scraping php_fpm by reason", []string{"reason"}),
+		processRequests:    newFuncMetric("process_requests", "Number of requests the worker has served", processLabels),
+		processStartTime:   newFuncMetric("process_start_time_seconds", "Unix time when the worker was started", processLabels),
+		processDuration:    newFuncMetric("process_request_duration_seconds", "Duration of the worker's current or last request", processLabels),
+		processContentLen:  newFuncMetric("process_request_content_length_bytes", "Content length of the worker's current or last request", processLabels),
+		processLastCPU:     newFuncMetric("process_last_request_cpu_ratio", "CPU used by the worker's last request as a ratio of one core", processLabels),
+		processLastMemory:  newFuncMetric("process_last_request_memory_bytes", "Peak memory used by the worker's last request", processLabels),
 	}
 }
 
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.up
 	ch <- c.scrapeFailures
+	ch <- c.snapshotAge
+	ch <- c.pingUp
+	ch <- c.socketBacklog
+	ch <- c.socketBacklogMax
+	ch <- c.poolMemory
+	ch <- c.poolCPU
+	ch <- c.poolFDs
+	ch <- c.poolThreads
+	ch <- c.poolCtxSwitches
+	ch <- c.masterUptime
+	ch <- c.poolPss
+	ch <- c.poolPrivate
+	ch <- c.memoryLimit
+	ch <- c.recommendedMax
+	for _, counter := range c.counters {
+		counter.Describe(ch)
+	}
+	for _, t := range c.targets {
+		t.fetchDuration.Describe(ch)
+		if t.slowlog != nil {
+			t.slowlog.Describe(ch)
+		}
+		if t.accessLog != nil {
+			t.accessLog.Describe(ch)
+		}
+		if t.pingDuration != nil {
+			ch <- t.pingDuration.Desc()
+		}
+	}
+	ch <- c.info
+	ch <- c.startTime
 	ch <- c.acceptedConn
 	ch <- c.listenQueue
 	ch <- c.maxListenQueue
 	ch <- c.listenQueueLength
 	ch <- c.phpProcesses
+	ch <- c.totalProcesses
+	ch <- c.maxChildren
+	ch <- c.startServers
+	ch <- c.minSpareServers
+	ch <- c.maxSpareServers
 	ch <- c.maxActiveProcesses
 	ch <- c.maxChildrenReached
 	ch <- c.slowRequests
+	ch <- c.utilization
+	ch <- c.saturated
+	ch <- c.queueWait
+	ch <- c.processRequests
+	ch <- c.processStartTime
+	ch <- c.processDuration
+	ch <- c.processContentLen
+	ch <- c.processLastCPU
+	ch <- c.processLastMemory
 }
 
-func getDataFastcgi(u *url.URL) ([]byte, error) {
-	path := u.Path
-	host := u.Host
+// statusFlags returns the query string flags to request from the status page.
+func statusFlags(full bool) []string {
+	if full {
+		return []string{"json", "full"}
+	}
+	return []string{"json"}
+}
 
-	if path == "" || u.Scheme == "unix" {
+// statusPath returns the path and query string to request the status page
+// of a target with.
+func (t *target) statusPath(full bool) (string, string) {
+	if !t.fastcgi() {
+		return t.url.Path, statusQuery(t.url.RawQuery, statusFlags(full)...)
+	}
+
+	path := t.url.Path
+	if t.url.Scheme == "unix" {
+		_, path = splitUnixPath(t.url.Path)
+	}
+	if t.FastCGI.StatusPath != "" {
+		path = t.FastCGI.StatusPath
+	}
+	if path == "" {
 		path = "/status"
 	}
+
+	query := t.url.RawQuery
+	if t.FastCGI.QueryString != "" {
+		query = t.FastCGI.QueryString
+	}
+	return path, statusQuery(query, statusFlags(full)...)
+}
+
+// getData requests path from a target and returns the body of the response.
+// The phases of the request are timed by trace, which may be nil.
+func getData(ctx context.Context, t *target, path string, query string, trace *fetchTrace) ([]byte, error) {
+	if t.fastcgi() {
+		return getDataFastcgi(ctx, t, path, query, trace)
+	}
+	return getDataHTTP(ctx, t, path, query, trace)
+}
+
+func getDataFastcgi(ctx context.Context, t *target, path string, query string, trace *fetchTrace) ([]byte, error) {
+	u := t.url
+	host := u.Host
 	if u.Scheme == "unix" {
-		host = u.Path
+		host, _ = splitUnixPath(u.Path)
+	}
+
+	method := t.FastCGI.RequestMethod
+	if method == "" {
+		method = "GET"
 	}
 
 	env := map[string]string{
-		"SCRIPT_FILENAME": path,
+		"SCRIPT_FILENAME": t.FastCGI.DocumentRoot + path,
 		"SCRIPT_NAME":     path,
+		"REQUEST_URI":     path + "?" + query,
+		"QUERY_STRING":    query,
+		"REQUEST_METHOD":  method,
+		"CONTENT_LENGTH":  "0",
+		"SERVER_PROTOCOL": "HTTP/1.1",
+	}
+	if t.FastCGI.DocumentRoot != "" {
+		env["DOCUMENT_ROOT"] = t.FastCGI.DocumentRoot
+	}
+	for name, value := range t.FastCGI.Params {
+		env[name] = value
 	}
 
-	fcgi, err := fcgiclient.Dial(u.Scheme, host)
+	dialTimeout := t.DialTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); dialTimeout == 0 || remaining < dialTimeout {
+			dialTimeout = remaining
+		}
+	}
+
+	trace.dialStarted()
+	fcgi, err := fcgiclient.DialTimeout(u.Scheme, host, dialTimeout)
 	if err != nil {
 		return nil, errors.Wrap(err, "fastcgi dial failed")
 	}
+	trace.dialed()
 
 	defer fcgi.Close()
 
-	resp, err := fcgi.Get(env)
+	if t.ReadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.ReadTimeout)
+		defer cancel()
+	}
+
+	// the fastcgi client does not support deadlines, so close the connection
+	// to unblock any reads once the context is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			fcgi.Close()
+		case <-done:
+		}
+	}()
+
+	resp, err := fcgi.Request(env, nil)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "fastcgi get failed")
+		}
 		return nil, errors.Wrap(err, "fastcgi get failed")
 	}
+	trace.firstByte()
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 && resp.StatusCode != 0 {
-		return nil, errors.Errorf("unexpected status: %d", resp.StatusCode)
+	if code := fastcgiStatus(resp); code != 200 {
+		return nil, &statusError{code: code}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "failed to read fastcgi body")
+		}
 		return nil, errors.Wrap(err, "failed to read fastcgi body")
 	}
+	trace.done()
 
 	return body, nil
 }
 
-func getDataHTTP(u *url.URL) ([]byte, error) {
-	req := http.Request{
+// fastcgiStatus returns the status code of a fastcgi response. The code is
+// only sent in the Status header, and a missing header means success.
+func fastcgiStatus(resp *http.Response) int {
+	if resp.StatusCode != 0 {
+		return resp.StatusCode
+	}
+
+	status := resp.Header.Get("Status")
+	if status == "" {
+		return 200
+	}
+
+	if i := strings.Index(status, " "); i >= 0 {
+		status = status[:i]
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+func getDataHTTP(ctx context.Context, t *target, path string, query string, trace *fetchTrace) ([]byte, error) {
+	u := &url.URL{
+		Scheme:   t.url.Scheme,
+		User:     t.url.User,
+		Host:     t.url.Host,
+		Path:     path,
+		RawQuery: query,
+	}
+
+	req := &http.Request{
 		Method:     "GET",
 		URL:        u,
 		Proto:      "HTTP/1.1",
@@ -123,7 +357,15 @@ func getDataHTTP(u *url.URL) ([]byte, error) {
 		Host:       u.Host,
 	}
 
-	resp, err := http.DefaultClient.Do(&req)
+	if err := t.HTTP.prepareRequest(req); err != nil {
+		return nil, errors.Wrap(err, "failed to prepare HTTP request")
+	}
+
+	if trace != nil {
+		ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	}
+
+	resp, err := t.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, errors.Wrap(err, "HTTP request failed")
 	}
@@ -131,102 +373,283 @@ func getDataHTTP(u *url.URL) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, errors.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+		return nil, &statusError{code: resp.StatusCode}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read http body")
 	}
+	trace.done()
 
 	return body, nil
 }
 
+// constMetric holds the values needed to create a constant metric.
+type constMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     float64
+	labels    []string
+}
+
+// processState normalizes a worker state such as "Reading headers"
+// into a label value.
+func processState(state string) string {
+	return strings.Replace(strings.ToLower(state), " ", "_", -1)
+}
+
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	up := 1.0
-	var (
-		body []byte
-		err  error
+	var wg sync.WaitGroup
+	for _, t := range c.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			ctx, cancel := t.scrapeContext(context.Background(), c.timeout)
+			defer cancel()
+			c.collectTarget(ctx, ch, t)
+		}(t)
+	}
+	for _, counter := range c.counters {
+		counter.Collect(ch)
+	}
+	wg.Wait()
+}
+
+// collectBacklog exports the backlog of the socket a fastcgi target listens
+// on. It is read at collection time, so it is available even when the
+// status page does not answer.
+func (c *collector) collectBacklog(ch chan<- prometheus.Metric, t *target, logger *zap.Logger) {
+	b, err := c.exporter.socketBacklog(t)
+	if err != nil {
+		logger.Debug("failed to read socket backlog", zap.Error(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.socketBacklog,
+		prometheus.GaugeValue,
+		float64(b.current),
+		t.Name,
 	)
+	if b.max > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			c.socketBacklogMax,
+			prometheus.GaugeValue,
+			float64(b.max),
+			t.Name,
+		)
+	}
+}
+
+// collectProcesses exports the resources used by the master and workers of
+// a target. They are read at collection time, so they are available even
+// when the status page does not answer.
+func (c *collector) collectProcesses(ch chan<- prometheus.Metric, t *target, logger *zap.Logger) {
+	p, err := c.exporter.poolProcesses(t)
+	if err != nil {
+		logger.Error("failed to read pool processes", zap.Error(err))
+		return
+	}
 
-	if c.exporter.fcgiEndpoint != nil && c.exporter.fcgiEndpoint.String() != "" {
-		body, err = getDataFastcgi(c.exporter.fcgiEndpoint)
+	metrics := []constMetric{
+		{c.masterUptime, prometheus.GaugeValue, p.uptime(time.Now()), nil},
+	}
+	if p.memoryLimitErr != nil {
+		logger.Warn("failed to read pool memory limit", zap.Error(p.memoryLimitErr))
 	} else {
-		body, err = getDataHTTP(c.exporter.endpoint)
+		metrics = append(metrics, constMetric{c.memoryLimit, prometheus.GaugeValue, p.memoryLimit, nil})
+	}
+	if n, ok := p.recommendedMaxChildren(c.exporter.capacityHeadroom); ok {
+		metrics = append(metrics, constMetric{c.recommendedMax, prometheus.GaugeValue, float64(n), nil})
+	}
+	for role, totals := range map[string]processTotals{"master": p.master, "workers": p.workers} {
+		labels := []string{role}
+		metrics = append(metrics, []constMetric{
+			{c.poolMemory, prometheus.GaugeValue, totals.residentMemory, labels},
+			{c.poolCPU, prometheus.CounterValue, totals.cpuSeconds, labels},
+			{c.poolFDs, prometheus.GaugeValue, totals.openFDs, labels},
+			{c.poolThreads, prometheus.GaugeValue, totals.threads, labels},
+			{c.poolCtxSwitches, prometheus.GaugeValue, totals.contextSwitches, labels},
+		}...)
+		if totals.smapsRead > 0 {
+			metrics = append(metrics, []constMetric{
+				{c.poolPss, prometheus.GaugeValue, totals.pss, labels},
+				{c.poolPrivate, prometheus.GaugeValue, totals.private, labels},
+			}...)
+		}
 	}
 
+	sendMetrics(ch, t, logger, metrics)
+}
+
+// scrapeTarget fetches and parses the status page of a target.
+func scrapeTarget(ctx context.Context, t *target, full bool) (*poolStatus, error) {
+	path, query := t.statusPath(full)
+	body, err := getData(ctx, t, path, query, t.newFetchTrace())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get php-fpm status")
+	}
+
+	status, err := parseStatus(body)
 	if err != nil {
+		return nil, errors.Wrap(&parseError{err: err}, "failed to parse php-fpm status")
+	}
+
+	return status, nil
+}
+
+func (c *collector) collectTarget(ctx context.Context, ch chan<- prometheus.Metric, t *target) {
+	up := 1.0
+
+	logger := c.exporter.logger.With(zap.String("target", t.Name))
+
+	var s *snapshot
+	if t.background() {
+		s = t.latestSnapshot()
+		if s != nil {
+			now := time.Now()
+			ch <- prometheus.MustNewConstMetric(
+				c.snapshotAge,
+				prometheus.GaugeValue,
+				now.Sub(s.time).Seconds(),
+				t.Name,
+			)
+			if t.stale(s, now) {
+				s = nil
+			}
+		}
+	} else {
+		s = c.exporter.scrape(ctx, t)
+	}
+
+	if s == nil || s.err != nil {
 		up = 0.0
-		c.exporter.logger.Error("failed to get php-fpm status", zap.Error(err))
-		c.failureCount++
 	}
+
 	ch <- prometheus.MustNewConstMetric(
 		c.up,
 		prometheus.GaugeValue,
 		up,
+		t.Name,
 	)
 
-	ch <- prometheus.MustNewConstMetric(
-		c.scrapeFailures,
-		prometheus.CounterValue,
-		float64(c.failureCount),
-	)
+	t.fetchDuration.Collect(ch)
+	if t.slowlog != nil {
+		t.slowlog.Collect(ch)
+	}
+	if t.accessLog != nil {
+		t.accessLog.Collect(ch)
+	}
+
+	if t.fastcgi() {
+		c.collectBacklog(ch, t, logger)
+	}
+
+	if t.processes() {
+		c.collectProcesses(ch, t, logger)
+	}
+
+	if t.pingDuration != nil {
+		pingUp := 0.0
+		if s != nil && s.ping != nil && s.ping.up {
+			pingUp = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.pingUp,
+			prometheus.GaugeValue,
+			pingUp,
+			t.Name,
+		)
+		ch <- t.pingDuration
+	}
+
+	failures := t.failureCounts()
+	for _, reason := range failureReasons {
+		ch <- prometheus.MustNewConstMetric(
+			c.scrapeFailures,
+			prometheus.CounterValue,
+			float64(failures[reason]),
+			t.Name,
+			reason,
+		)
+	}
 
 	if up == 0.0 {
 		return
 	}
 
-	matches := statusLineRegexp.FindAllStringSubmatch(string(body), -1)
-	for _, match := range matches {
-		key := match[1]
-		value, err := strconv.Atoi(match[2])
-		if err != nil {
-			continue
-		}
+	status := s.status
+	metrics := []constMetric{
+		{c.info, prometheus.GaugeValue, 1, []string{status.Pool, status.ProcessManager}},
+		{c.startTime, prometheus.GaugeValue, float64(status.StartTime), nil},
+		{c.acceptedConn, prometheus.CounterValue, float64(status.AcceptedConn), nil},
+		{c.listenQueue, prometheus.GaugeValue, float64(status.ListenQueue), nil},
+		{c.maxListenQueue, prometheus.CounterValue, float64(status.MaxListenQueue), nil},
+		{c.listenQueueLength, prometheus.GaugeValue, float64(status.ListenQueueLen), nil},
+		{c.phpProcesses, prometheus.GaugeValue, float64(status.IdleProcesses), []string{"idle"}},
+		{c.phpProcesses, prometheus.GaugeValue, float64(status.ActiveProcesses), []string{"active"}},
+		{c.totalProcesses, prometheus.GaugeValue, float64(status.TotalProcesses), nil},
+		{c.maxActiveProcesses, prometheus.CounterValue, float64(status.MaxActiveProcesses), nil},
+		{c.maxChildrenReached, prometheus.CounterValue, float64(status.MaxChildrenReached), nil},
+		{c.slowRequests, prometheus.CounterValue, float64(status.SlowRequests), nil},
+	}
 
-		var desc *prometheus.Desc
-		var valueType prometheus.ValueType
-		labels := []string{}
-
-		switch key {
-		case "accepted conn":
-			desc = c.acceptedConn
-			valueType = prometheus.CounterValue
-		case "listen queue":
-			desc = c.listenQueue
-			valueType = prometheus.GaugeValue
-		case "max listen queue":
-			desc = c.maxListenQueue
-			valueType = prometheus.CounterValue
-		case "listen queue len":
-			desc = c.listenQueueLength
-			valueType = prometheus.GaugeValue
-		case "idle processes":
-			desc = c.phpProcesses
-			valueType = prometheus.GaugeValue
-			labels = append(labels, "idle")
-		case "active processes":
-			desc = c.phpProcesses
-			valueType = prometheus.GaugeValue
-			labels = append(labels, "active")
-		case "max active processes":
-			desc = c.maxActiveProcesses
-			valueType = prometheus.CounterValue
-		case "max children reached":
-			desc = c.maxChildrenReached
-			valueType = prometheus.CounterValue
-		case "slow requests":
-			desc = c.slowRequests
-			valueType = prometheus.CounterValue
-		default:
-			continue
+	derived := s.derived
+	saturated := 0.0
+	if derived.saturated {
+		saturated = 1.0
+	}
+	metrics = append(metrics,
+		constMetric{c.utilization, prometheus.GaugeValue, derived.utilization, nil},
+		constMetric{c.saturated, prometheus.GaugeValue, saturated, nil},
+	)
+	if derived.hasQueueWait {
+		metrics = append(metrics, constMetric{c.queueWait, prometheus.GaugeValue, derived.queueWait, nil})
+	}
+
+	limits, err := t.limits(status.Pool)
+	if err != nil {
+		logger.Warn("failed to read pool limits", zap.Error(err))
+	}
+
+	for _, limit := range []struct {
+		desc  *prometheus.Desc
+		value int64
+	}{
+		{c.maxChildren, limits.MaxChildren},
+		{c.startServers, limits.StartServers},
+		{c.minSpareServers, limits.MinSpareServers},
+		{c.maxSpareServers, limits.MaxSpareServers},
+	} {
+		if limit.value > 0 {
+			metrics = append(metrics, constMetric{limit.desc, prometheus.GaugeValue, float64(limit.value), nil})
 		}
+	}
+
+	for _, p := range status.Processes {
+		labels := []string{strconv.FormatInt(p.PID, 10), processState(p.State)}
+		metrics = append(metrics, []constMetric{
+			{c.processRequests, prometheus.GaugeValue, float64(p.Requests), labels},
+			{c.processStartTime, prometheus.GaugeValue, float64(p.StartTime), labels},
+			{c.processDuration, prometheus.GaugeValue, float64(p.RequestDuration) / 1e6, labels},
+			{c.processContentLen, prometheus.GaugeValue, float64(p.ContentLength), labels},
+			{c.processLastCPU, prometheus.GaugeValue, p.LastRequestCPU / 100, labels},
+			{c.processLastMemory, prometheus.GaugeValue, float64(p.LastRequestMemory), labels},
+		}...)
+	}
+
+	sendMetrics(ch, t, logger, metrics)
+}
 
-		m, err := prometheus.NewConstMetric(desc, valueType, float64(value), labels...)
+// sendMetrics creates the constant metrics of a target.
+func sendMetrics(ch chan<- prometheus.Metric, t *target, logger *zap.Logger, metrics []constMetric) {
+	for _, metric := range metrics {
+		labels := append([]string{t.Name}, metric.labels...)
+		m, err := prometheus.NewConstMetric(metric.desc, metric.valueType, metric.value, labels...)
 		if err != nil {
-			c.exporter.logger.Error(
+			logger.Error(
 				"failed to create metrics",
-				zap.String("key", key),
 				zap.Error(err),
 			)
 			continue
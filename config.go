@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config is the format of the configuration file.
+type config struct {
+	Targets []targetConfig `yaml:"targets"`
+	// ErrorLogs are php-fpm error_log files to count events from.
+	ErrorLogs []string `yaml:"error_logs"`
+	// LabelRules rewrite request URIs and scripts before they are used as
+	// label values.
+	LabelRules []labelRule `yaml:"label_rules"`
+}
+
+// targetConfig configures a single php-fpm pool.
+type targetConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// DialTimeout limits how long connecting to php-fpm may take.
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// ReadTimeout limits how long php-fpm may take to send the status page
+	// once connected.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// ScrapeTimeout limits the whole scrape of the target.
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout"`
+	// ScrapeInterval enables scraping the target in the background on this
+	// interval. Collections are then served from the latest snapshot.
+	ScrapeInterval time.Duration `yaml:"scrape_interval"`
+	// MaxStaleness is the age after which a background snapshot is no
+	// longer reported as up. It defaults to three scrape intervals.
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	// MinInterval is the shortest time between two status requests to the
+	// pool. Scrapes within it are served the previous result.
+	MinInterval time.Duration `yaml:"min_interval"`
+	// HTTP configures the client for http and https targets.
+	HTTP httpClientConfig `yaml:"http"`
+	// FastCGI configures the request sent to tcp and unix targets.
+	FastCGI fastcgiConfig `yaml:"fastcgi"`
+	// Ping configures a check of the pool's ping.path.
+	Ping pingConfig `yaml:"ping"`
+	// PidFile is the pid file of the pool's master process, used to read
+	// the resources used by the master and its workers from procfs.
+	PidFile string `yaml:"pid_file"`
+	// Pid is the pid of the pool's master process, if there is no PidFile.
+	Pid int `yaml:"pid"`
+	// Slowlog is the slowlog file of the pool, which is followed to count
+	// slow requests by script and stack frame.
+	Slowlog string `yaml:"slowlog"`
+	// AccessLog is the access log of the pool, which is followed to export
+	// request histograms.
+	AccessLog accessLogConfig `yaml:"access_log"`
+	// PoolConfigFile is a php-fpm configuration file to read the pool's
+	// process manager limits from. It is read on every scrape.
+	PoolConfigFile string `yaml:"pool_config_file"`
+	// PoolName selects the pool in PoolConfigFile. It defaults to the pool
+	// name reported on the status page.
+	PoolName string `yaml:"pool_name"`
+	// Limits are the pool's process manager limits. They take precedence
+	// over those read from PoolConfigFile.
+	Limits poolLimits `yaml:"limits"`
+}
+
+// fastcgiConfig configures the parameters of the fastcgi status request.
+type fastcgiConfig struct {
+	// StatusPath is the pm.status_path of the pool. It defaults to the path
+	// of the URL, or /status.
+	StatusPath string `yaml:"status_path"`
+	// QueryString is sent as QUERY_STRING. The json and full flags are
+	// added as needed.
+	QueryString   string `yaml:"query_string"`
+	RequestMethod string `yaml:"request_method"`
+	DocumentRoot  string `yaml:"document_root"`
+	// Params are extra fastcgi parameters. They override any others.
+	Params map[string]string `yaml:"params"`
+}
+
+func loadConfig(filename string) (*config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file %s", filename)
+	}
+
+	return &c, nil
+}
+
+// SetConfigFile creates a function that will load targets, error logs and label rules from a configuration file.
+// Generally only used when create a new Exporter.
+func SetConfigFile(filename string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if filename == "" {
+			return nil
+		}
+
+		c, err := loadConfig(filename)
+		if err != nil {
+			return err
+		}
+
+		for _, tc := range c.Targets {
+			if err := e.addTarget(tc); err != nil {
+				return err
+			}
+		}
+		for _, filename := range c.ErrorLogs {
+			if err := AddErrorLog(filename)(e); err != nil {
+				return err
+			}
+		}
+		for _, rule := range c.LabelRules {
+			if err := AddLabelRule(rule.Match, rule.Replacement)(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
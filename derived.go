@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"time"
+)
+
+// statusSample is the part of a previous scrape needed to compute rates.
+type statusSample struct {
+	time               time.Time
+	startTime          int64
+	acceptedConn       int64
+	maxChildrenReached int64
+}
+
+// derivedStatus holds metrics computed from the status page and the
+// previous scrape of the same target.
+type derivedStatus struct {
+	// utilization is the ratio of active to total processes.
+	utilization float64
+	// saturated is set when connections are waiting in the listen queue, or
+	// the process limit was reached since the previous scrape.
+	saturated bool
+	// queueWait is the estimated time a connection waits in the listen
+	// queue. It is only valid if hasQueueWait is set.
+	queueWait    float64
+	hasQueueWait bool
+}
+
+// derive computes derived metrics for a status taken at now and remembers
+// it for the next scrape.
+func (t *target) derive(now time.Time, status *poolStatus) derivedStatus {
+	t.mu.Lock()
+	previous := t.previous
+	t.previous = &statusSample{
+		time:               now,
+		startTime:          status.StartTime,
+		acceptedConn:       status.AcceptedConn,
+		maxChildrenReached: status.MaxChildrenReached,
+	}
+	t.mu.Unlock()
+
+	var d derivedStatus
+	if status.TotalProcesses > 0 {
+		d.utilization = float64(status.ActiveProcesses) / float64(status.TotalProcesses)
+	}
+
+	d.saturated = status.ListenQueue > 0
+
+	if status.ListenQueue == 0 {
+		d.hasQueueWait = true
+	}
+
+	// counters reset when php-fpm restarts, so only compare against a
+	// previous scrape of the same php-fpm process.
+	if previous == nil || previous.startTime != status.StartTime || !now.After(previous.time) {
+		return d
+	}
+
+	if status.MaxChildrenReached > previous.maxChildrenReached {
+		d.saturated = true
+	}
+
+	// Little's law: the average wait is the queue length divided by the
+	// arrival rate.
+	accepted := status.AcceptedConn - previous.acceptedConn
+	if status.ListenQueue > 0 && accepted > 0 {
+		rate := float64(accepted) / now.Sub(previous.time).Seconds()
+		d.queueWait = float64(status.ListenQueue) / rate
+		d.hasQueueWait = true
+	}
+
+	return d
+}
@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDerive(t *testing.T) {
+	target, err := newTarget(targetConfig{Name: "www", URL: "http://localhost/status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2019, 10, 21, 10, 20, 30, 0, time.UTC)
+
+	// each scrape is compared against the one before it.
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		status   poolStatus
+		expected derivedStatus
+	}{
+		{
+			name:     "first scrape",
+			status:   poolStatus{StartTime: 1, AcceptedConn: 100, ActiveProcesses: 1, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 0.25, hasQueueWait: true},
+		},
+		{
+			name:     "queued connections",
+			offset:   10 * time.Second,
+			status:   poolStatus{StartTime: 1, AcceptedConn: 200, ListenQueue: 5, ActiveProcesses: 4, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 1, saturated: true, queueWait: 0.5, hasQueueWait: true},
+		},
+		{
+			name:     "max children reached",
+			offset:   20 * time.Second,
+			status:   poolStatus{StartTime: 1, AcceptedConn: 300, MaxChildrenReached: 1, ActiveProcesses: 2, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 0.5, saturated: true, hasQueueWait: true},
+		},
+		{
+			name:     "max children not reached again",
+			offset:   30 * time.Second,
+			status:   poolStatus{StartTime: 1, AcceptedConn: 400, MaxChildrenReached: 1, ActiveProcesses: 2, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 0.5, hasQueueWait: true},
+		},
+		{
+			name:     "restarted",
+			offset:   40 * time.Second,
+			status:   poolStatus{StartTime: 2, AcceptedConn: 10, ListenQueue: 3, ActiveProcesses: 4, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 1, saturated: true},
+		},
+		{
+			name:     "no new connections",
+			offset:   50 * time.Second,
+			status:   poolStatus{StartTime: 2, AcceptedConn: 10, ListenQueue: 3, ActiveProcesses: 4, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 1, saturated: true},
+		},
+		{
+			name:     "same time",
+			offset:   50 * time.Second,
+			status:   poolStatus{StartTime: 2, AcceptedConn: 20, ListenQueue: 3, ActiveProcesses: 4, TotalProcesses: 4},
+			expected: derivedStatus{utilization: 1, saturated: true},
+		},
+		{
+			name:     "no processes",
+			offset:   60 * time.Second,
+			status:   poolStatus{StartTime: 2, AcceptedConn: 20},
+			expected: derivedStatus{hasQueueWait: true},
+		},
+	}
+
+	for _, test := range tests {
+		status := test.status
+		if got := target.derive(start.Add(test.offset), &status); got != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, got)
+		}
+	}
+}
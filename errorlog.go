@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Events counted from the php-fpm error log. These are the values of the
+// event label on phpfpm_error_log_events_total.
+const (
+	eventMaxChildrenReached = "max_children_reached"
+	eventChildSignaled      = "child_signaled"
+	eventChildExited        = "child_exited"
+	eventExecutionTimedOut  = "execution_timed_out"
+	eventSeemsBusy          = "seems_busy"
+)
+
+var (
+	errorLogPool = regexp.MustCompile(`\[pool ([^\]]+)\]`)
+
+	errorLogEvents = []struct {
+		event   string
+		pattern *regexp.Regexp
+	}{
+		{eventMaxChildrenReached, regexp.MustCompile(`server reached (?:pm\.)?max_children setting`)},
+		{eventChildSignaled, regexp.MustCompile(`child \d+ exited on signal \d+ \((\w+)[^)]*\)`)},
+		// children exiting with code 0 are recycled normally.
+		{eventChildExited, regexp.MustCompile(`child \d+ exited with code [1-9]\d*`)},
+		{eventExecutionTimedOut, regexp.MustCompile(`execution timed out`)},
+		{eventSeemsBusy, regexp.MustCompile(`seems busy`)},
+	}
+)
+
+// errorLogEvent is an event read from the error log.
+type errorLogEvent struct {
+	pool   string
+	event  string
+	signal string
+}
+
+// parseErrorLogLine classifies a line of the php-fpm error log, such as
+// [17-Oct-2026 10:20:30] WARNING: [pool www] child 1234 exited on signal 11 (SIGSEGV - core dumped) after 12.3 seconds from start
+// It returns false if the line is not one of the counted events.
+func parseErrorLogLine(line string) (errorLogEvent, bool) {
+	for _, e := range errorLogEvents {
+		m := e.pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		ev := errorLogEvent{event: e.event}
+		if len(m) > 1 {
+			ev.signal = m[1]
+		}
+		if m := errorLogPool.FindStringSubmatch(line); m != nil {
+			ev.pool = m[1]
+		}
+		return ev, true
+	}
+	return errorLogEvent{}, false
+}
+
+func newErrorLogCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "error_log_events_total",
+		Help:      "Number of events written to the php-fpm error log by pool, event and signal",
+	}, []string{"pool", "event", "signal"})
+}
+
+// AddErrorLog creates a function that will follow a php-fpm error_log and
+// count the events written to it.
+// Generally only used when create a new Exporter.
+func AddErrorLog(filename string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		for _, f := range e.errorLogs {
+			if f == filename {
+				return nil
+			}
+		}
+		e.errorLogs = append(e.errorLogs, filename)
+		return nil
+	}
+}
+
+// tailErrorLog follows an error log until the context is canceled.
+func (e *Exporter) tailErrorLog(ctx context.Context, filename string) {
+	newTailer(filename, e.logger).run(ctx, func(line string) {
+		if ev, ok := parseErrorLogLine(line); ok {
+			e.errorLogEvents.WithLabelValues(ev.pool, ev.event, ev.signal).Inc()
+		}
+	})
+}
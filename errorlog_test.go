@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestParseErrorLogLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected errorLogEvent
+		ok       bool
+	}{
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] server reached pm.max_children setting (5), consider raising it",
+			expected: errorLogEvent{pool: "www", event: eventMaxChildrenReached},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] server reached max_children setting (5), consider raising it",
+			expected: errorLogEvent{pool: "www", event: eventMaxChildrenReached},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] child 1234 exited on signal 11 (SIGSEGV - core dumped) after 12.345678 seconds from start",
+			expected: errorLogEvent{pool: "www", event: eventChildSignaled, signal: "SIGSEGV"},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] child 1234 exited on signal 11 (SIGSEGV) after 12.345678 seconds from start",
+			expected: errorLogEvent{pool: "www", event: eventChildSignaled, signal: "SIGSEGV"},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool api] child 1234 exited on signal 9 (SIGKILL) after 3.000000 seconds from start",
+			expected: errorLogEvent{pool: "api", event: eventChildSignaled, signal: "SIGKILL"},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] child 1234 exited with code 255 after 1.234567 seconds from start",
+			expected: errorLogEvent{pool: "www", event: eventChildExited},
+			ok:       true,
+		},
+		{
+			line: "[21-Oct-2019 10:20:30] NOTICE: [pool www] child 1234 exited with code 0 after 600.123456 seconds from start",
+		},
+		{
+			line:     `[21-Oct-2019 10:20:30] WARNING: [pool www] child 1234, script '/var/www/index.php' (request: "GET /index.php") execution timed out (30.123456 sec), terminating`,
+			expected: errorLogEvent{pool: "www", event: eventExecutionTimedOut},
+			ok:       true,
+		},
+		{
+			line:     "[21-Oct-2019 10:20:30] WARNING: [pool www] seems busy (you may need to increase pm.start_servers, or pm.min/max_spare_servers), spawning 8 children, there are 0 idle, and 10 total children",
+			expected: errorLogEvent{pool: "www", event: eventSeemsBusy},
+			ok:       true,
+		},
+		{
+			line: "[21-Oct-2019 10:20:30] NOTICE: [pool www] child 1235 started",
+		},
+		{
+			line: "[21-Oct-2019 10:20:30] NOTICE: fpm is running, pid 1",
+		},
+		{
+			line: "[21-Oct-2019 10:20:30] NOTICE: ready to handle connections",
+		},
+	}
+
+	for _, test := range tests {
+		ev, ok := parseErrorLogLine(test.line)
+		if ok != test.ok || ev != test.expected {
+			t.Errorf("%s: expected %+v %v, got %+v %v", test.line, test.expected, test.ok, ev, ok)
+		}
+	}
+}
@@ -5,9 +5,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
-	"syscall"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -19,11 +18,33 @@ import (
 
 // Exporter handles serving the metrics
 type Exporter struct {
-	addr            string
-	endpoint        *url.URL
-	fcgiEndpoint    *url.URL
-	logger          *zap.Logger
-	metricsEndpoint string
+	addr             string
+	endpoint         *url.URL
+	fcgiEndpoint     *url.URL
+	targets          []*target
+	logger           *zap.Logger
+	metricsEndpoint  string
+	full             bool
+	probeAllow       []*regexp.Regexp
+	dialTimeout      time.Duration
+	readTimeout      time.Duration
+	scrapeTimeout    time.Duration
+	scrapeInterval   time.Duration
+	maxStaleness     time.Duration
+	minInterval      time.Duration
+	procPath         string
+	sysPath          string
+	capacityHeadroom float64
+	maxLabelValues   int
+	slowlogWindow    time.Duration
+	errorLogs        []string
+	errorLogEvents   *prometheus.CounterVec
+	// paths normalizes request URIs and scripts used as label values.
+	paths              pathNormalizer
+	droppedLabelValues *prometheus.CounterVec
+	runtimeMetrics     bool
+	registry           *prometheus.Registry
+	webConfig          *webConfig
 }
 
 // OptionsFunc is a function passed to new for setting options on a new Exporter.
@@ -32,7 +53,16 @@ type OptionsFunc func(*Exporter) error
 // New creates an exporter.
 func New(options ...OptionsFunc) (*Exporter, error) {
 	e := &Exporter{
-		addr: ":9090",
+		addr:             ":9090",
+		metricsEndpoint:  "/metrics",
+		dialTimeout:      time.Second,
+		readTimeout:      5 * time.Second,
+		scrapeTimeout:    10 * time.Second,
+		procPath:         "/proc",
+		sysPath:          "/sys",
+		capacityHeadroom: 0.1,
+		maxLabelValues:   100,
+		slowlogWindow:    10 * time.Minute,
 	}
 
 	for _, f := range options {
@@ -49,10 +79,46 @@ func New(options ...OptionsFunc) (*Exporter, error) {
 		e.logger = l
 	}
 
-	if e.endpoint == nil && e.fcgiEndpoint == nil {
-		u, _ := url.Parse("http://localhost:9000/status")
-		e.endpoint = u
+	if len(e.targets) == 0 {
+		u := e.fcgiEndpoint
+		if u == nil {
+			u = e.endpoint
+		}
+		rawurl := "http://localhost:9000/status"
+		if u != nil {
+			rawurl = u.String()
+		}
+		if err := e.addTarget(targetConfig{Name: "default", URL: rawurl}); err != nil {
+			return nil, err
+		}
+	}
+
+	e.droppedLabelValues = newDroppedLabelCounter()
+	for _, t := range e.targets {
+		if err := e.prepareTarget(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.errorLogs) > 0 {
+		e.errorLogEvents = newErrorLogCounter()
 	}
+
+	e.registry = prometheus.NewRegistry()
+	for _, counter := range e.counters() {
+		if err := e.registry.Register(counter); err != nil {
+			return nil, errors.Wrap(err, "failed to register counter")
+		}
+	}
+	if e.runtimeMetrics {
+		if err := e.registry.Register(prometheus.NewGoCollector()); err != nil {
+			return nil, errors.Wrap(err, "failed to register go collector")
+		}
+		if err := e.registry.Register(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{})); err != nil {
+			return nil, errors.Wrap(err, "failed to register process collector")
+		}
+	}
+
 	return e, nil
 }
 
@@ -112,6 +178,17 @@ func SetFastcgi(rawurl string) func(*Exporter) error {
 	}
 }
 
+// AddTarget creates a function that will add a named php-fpm pool to scrape.
+// The scheme of the URL selects the protocol: http and https use HTTP, while
+// tcp and unix use fastcgi. If any targets are added, the endpoints set by
+// SetEndpoint and SetFastcgi are ignored.
+// Generally only used when create a new Exporter.
+func AddTarget(name string, rawurl string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		return e.addTarget(targetConfig{Name: name, URL: rawurl})
+	}
+}
+
 // SetMetricsEndpoint sets the path under which to expose metrics.
 // Generally only used when create a new Exporter.
 func SetMetricsEndpoint(path string) func(*Exporter) error {
@@ -124,48 +201,289 @@ func SetMetricsEndpoint(path string) func(*Exporter) error {
 	}
 }
 
-var healthzOK = []byte("ok\n")
+// SetFull creates a function that will enable requesting the full status page
+// and exporting metrics for each worker.
+// Generally only used when create a new Exporter.
+func SetFull(full bool) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.full = full
+		return nil
+	}
+}
 
-func (e *Exporter) healthz(w http.ResponseWriter, r *http.Request) {
-	_, _ = w.Write(healthzOK)
+// SetDialTimeout creates a function that will set the default timeout for
+// connecting to php-fpm.
+// Generally only used when create a new Exporter.
+func SetDialTimeout(timeout time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.dialTimeout = timeout
+		return nil
+	}
 }
 
-// Run starts the http server and collecting metrics. It generally does not return.
-func (e *Exporter) Run() error {
+// SetReadTimeout creates a function that will set the default timeout for
+// reading the status page once connected to php-fpm.
+// Generally only used when create a new Exporter.
+func SetReadTimeout(timeout time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.readTimeout = timeout
+		return nil
+	}
+}
+
+// SetScrapeTimeout creates a function that will set the default timeout for
+// a whole scrape of a target. A shorter timeout requested by Prometheus
+// takes precedence.
+// Generally only used when create a new Exporter.
+func SetScrapeTimeout(timeout time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.scrapeTimeout = timeout
+		return nil
+	}
+}
+
+// SetScrapeInterval creates a function that will set the default interval
+// for scraping targets in the background. Zero, the default, scrapes targets
+// on each collection instead.
+// Generally only used when create a new Exporter.
+func SetScrapeInterval(interval time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.scrapeInterval = interval
+		return nil
+	}
+}
 
-	c := e.newCollector()
-	if err := prometheus.Register(c); err != nil {
-		return errors.Wrap(err, "failed to register metrics")
+// SetMaxStaleness creates a function that will set the default age after
+// which a background snapshot is no longer reported as up. Zero means three
+// scrape intervals.
+// Generally only used when create a new Exporter.
+func SetMaxStaleness(staleness time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.maxStaleness = staleness
+		return nil
 	}
-	prometheus.Unregister(prometheus.NewProcessCollector(os.Getpid(), ""))
-	prometheus.Unregister(prometheus.NewGoCollector())
+}
 
-	http.HandleFunc("/healthz", e.healthz)
-	http.Handle(e.metricsEndpoint, promhttp.Handler())
+// SetMinInterval creates a function that will set the default shortest time
+// between two status requests to a target. Scrapes within it are served the
+// previous result.
+// Generally only used when create a new Exporter.
+func SetMinInterval(interval time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.minInterval = interval
+		return nil
+	}
+}
+
+// SetProcfsPath creates a function that will set where the proc filesystem
+// is mounted. It defaults to /proc.
+// Generally only used when create a new Exporter.
+func SetProcfsPath(path string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.procPath = path
+		return nil
+	}
+}
+
+// SetSysfsPath creates a function that will set where the sys filesystem
+// is mounted. It defaults to /sys.
+// Generally only used when create a new Exporter.
+func SetSysfsPath(path string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.sysPath = path
+		return nil
+	}
+}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
+// SetCapacityHeadroom creates a function that will set the fraction of the
+// memory available to a pool that is kept free when recommending
+// pm.max_children. It defaults to 0.1.
+// Generally only used when create a new Exporter.
+func SetCapacityHeadroom(headroom float64) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if headroom < 0 || headroom >= 1 {
+			return errors.Errorf("capacity headroom must be at least 0 and less than 1, got %v", headroom)
+		}
+		e.capacityHeadroom = headroom
+		return nil
+	}
+}
+
+// SetMaxLabelValues creates a function that will set the largest number of
+// distinct values of labels taken from logs, such as the script of a slow
+// request. Further values are replaced by "other". It defaults to 100.
+// Generally only used when create a new Exporter.
+func SetMaxLabelValues(max int) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if max < 1 {
+			return errors.Errorf("max label values must be at least 1, got %d", max)
+		}
+		e.maxLabelValues = max
+		return nil
+	}
+}
+
+// SetSlowlogWindow creates a function that will set how long slowlog stack
+// traces are kept for /slowlog/stacks. It defaults to 10 minutes.
+// Generally only used when create a new Exporter.
+func SetSlowlogWindow(window time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if window <= 0 {
+			return errors.New("slowlog window must be positive")
+		}
+		e.slowlogWindow = window
+		return nil
+	}
+}
+
+// SetRuntimeMetrics creates a function that will enable exporting the Go
+// runtime and process metrics of the exporter itself.
+// Generally only used when create a new Exporter.
+func SetRuntimeMetrics(enabled bool) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.runtimeMetrics = enabled
+		return nil
+	}
+}
+
+// timeoutOffset is subtracted from the scrape timeout requested by Prometheus
+// so there is time to send the response.
+const timeoutOffset = 500 * time.Millisecond
+
+// requestTimeout returns the scrape timeout requested by Prometheus, or zero
+// if there is none.
+func requestTimeout(r *http.Request) time.Duration {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > timeoutOffset {
+		timeout -= timeoutOffset
+	}
+	return timeout
+}
+
+// serveTargets scrapes the targets and writes their metrics along with
+// those from any other gatherers.
+func (e *Exporter) serveTargets(w http.ResponseWriter, r *http.Request, targets []*target, gatherers ...prometheus.Gatherer) {
+	c := e.newCollector(targets)
+	c.timeout = requestTimeout(r)
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		e.logger.Error("failed to register collector", zap.Error(err))
+		http.Error(w, "failed to register metrics", http.StatusInternalServerError)
+		return
+	}
+
+	gatherers = append(gatherers, registry)
+	promhttp.HandlerFor(prometheus.Gatherers(gatherers), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+func (e *Exporter) metrics(w http.ResponseWriter, r *http.Request) {
+	e.serveTargets(w, r, e.targets, e.registry)
+}
+
+var healthzOK = []byte("ok\n")
+
+func (e *Exporter) healthz(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write(healthzOK)
+}
+
+func (e *Exporter) index(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(`<html>
 			<head><title>php-fpm exporter</title></head>
 			<body>
 			<h1>php-fpm exporter</h1>
 			<p><a href="` + e.metricsEndpoint + `">Metrics</a></p>
+			<p><a href="/probe?target=tcp://127.0.0.1:9000/status">Probe</a></p>
+			<p><a href="/slowlog/stacks?format=svg">Slowlog flamegraph</a></p>
 			</body>
 			</html>`))
-	})
+}
 
-	stopChan := make(chan os.Signal)
-	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+// Collector returns a collector that scrapes all configured targets and
+// includes the counters updated by RunBackground.
+// It can be registered with any registry when embedding the exporter.
+func (e *Exporter) Collector() prometheus.Collector {
+	c := e.newCollector(e.targets)
+	c.counters = e.counters()
+	return c
+}
 
-	srv := &http.Server{Addr: e.addr}
-	var g errgroup.Group
+// counters returns the exporter wide counters, which are not tied to a
+// single scrape.
+func (e *Exporter) counters() []prometheus.Collector {
+	counters := []prometheus.Collector{e.droppedLabelValues}
+	if e.errorLogEvents != nil {
+		counters = append(counters, e.errorLogEvents)
+	}
+	return counters
+}
+
+// Handler returns the http handler that serves metrics, probes, slowlog
+// stacks and the health check. Metrics are gathered from a private registry
+// rather than the global one.
+func (e *Exporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", e.healthz)
+	mux.HandleFunc(e.metricsEndpoint, e.metrics)
+	mux.HandleFunc("/probe", e.probe)
+	mux.HandleFunc("/slowlog/stacks", e.slowlogStacks)
+	mux.HandleFunc("/", e.index)
+	return mux
+}
+
+// Run starts the http server and collecting metrics. It runs until the
+// context is canceled or the server fails.
+func (e *Exporter) Run(ctx context.Context) error {
+	handler := e.Handler()
+	if e.webConfig != nil && len(e.webConfig.Users) > 0 {
+		handler = newBasicAuth(e.webConfig.Users, handler)
+	}
+
+	srv := &http.Server{
+		Addr:    e.addr,
+		Handler: handler,
+	}
+
+	if e.webConfig.tlsEnabled() {
+		tlsConfig, err := newTLSConfig(&e.webConfig.TLSConfig)
+		if err != nil {
+			return errors.Wrap(err, "failed to configure TLS")
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return e.RunBackground(ctx)
+	})
 
 	g.Go(func() error {
-		// TODO: allow TLS
-		return srv.ListenAndServe()
+		var err error
+		if srv.TLSConfig != nil {
+			// certificates are provided by the TLS config.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			return err
+		}
+		return nil
 	})
 
 	g.Go(func() error {
-		<-stopChan
+		<-ctx.Done()
 		// XXX: should shutdown time be configurable?
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -173,7 +491,7 @@ func (e *Exporter) Run() error {
 		return nil
 	})
 
-	if err := g.Wait(); err != http.ErrServerClosed {
+	if err := g.Wait(); err != nil {
 		return errors.Wrap(err, "failed to run server")
 	}
 
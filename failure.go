@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons a scrape of a target can fail. These are the values of the reason
+// label on phpfpm_scrape_failures_total.
+const (
+	reasonConnectionRefused = "connection_refused"
+	reasonSocketMissing     = "socket_missing"
+	reasonPermissionDenied  = "permission_denied"
+	reasonTimeout           = "timeout"
+	reasonBadStatus         = "bad_status"
+	reasonEmptyBody         = "empty_body"
+	reasonParseError        = "parse_error"
+	reasonOther             = "other"
+)
+
+var failureReasons = []string{
+	reasonConnectionRefused,
+	reasonSocketMissing,
+	reasonPermissionDenied,
+	reasonTimeout,
+	reasonBadStatus,
+	reasonEmptyBody,
+	reasonParseError,
+	reasonOther,
+}
+
+// errEmptyStatus is returned when php-fpm sends an empty status page.
+var errEmptyStatus = errors.New("empty status page")
+
+// statusError is returned when php-fpm responds with a status other than 200.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.code)
+}
+
+// parseError is returned when the status page cannot be parsed.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+// failureReason classifies an error from scraping a target.
+func failureReason(err error) string {
+	cause := errors.Cause(err)
+
+	if cause == context.DeadlineExceeded {
+		return reasonTimeout
+	}
+	if e, ok := cause.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return reasonTimeout
+	}
+
+	switch e := cause.(type) {
+	case *statusError:
+		return reasonBadStatus
+	case *parseError:
+		if errors.Cause(e.err) == errEmptyStatus {
+			return reasonEmptyBody
+		}
+		return reasonParseError
+	}
+
+	if errno, ok := causeErrno(cause); ok {
+		switch errno {
+		case syscall.ECONNREFUSED:
+			return reasonConnectionRefused
+		case syscall.ENOENT:
+			return reasonSocketMissing
+		case syscall.EACCES, syscall.EPERM:
+			return reasonPermissionDenied
+		}
+	}
+
+	return reasonOther
+}
+
+// causeErrno unwraps the errors returned by the net and os packages
+// to find the underlying system call error.
+func causeErrno(err error) (syscall.Errno, bool) {
+	for {
+		switch e := err.(type) {
+		case syscall.Errno:
+			return e, true
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case *os.PathError:
+			err = e.Err
+		case *url.Error:
+			err = errors.Cause(e.Err)
+		default:
+			return 0, false
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package exporter
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "failed to get php-fpm status"), reasonTimeout},
+		{"network timeout", &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, reasonTimeout},
+		{
+			"connection refused",
+			errors.Wrap(&net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, "failed to connect"),
+			reasonConnectionRefused,
+		},
+		{
+			"connection refused over http",
+			&url.Error{Op: "Get", URL: "http://localhost/status", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+			reasonConnectionRefused,
+		},
+		{"socket missing", &net.OpError{Op: "dial", Net: "unix", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ENOENT}}, reasonSocketMissing},
+		{"permission denied", &net.OpError{Op: "dial", Net: "unix", Err: &os.SyscallError{Syscall: "connect", Err: syscall.EACCES}}, reasonPermissionDenied},
+		{"not permitted", &os.PathError{Op: "open", Path: "/run/php/www.sock", Err: syscall.EPERM}, reasonPermissionDenied},
+		{"bad status", errors.Wrap(&statusError{code: 404}, "failed to get php-fpm status"), reasonBadStatus},
+		{"empty body", errors.Wrap(&parseError{err: errEmptyStatus}, "failed to parse php-fpm status"), reasonEmptyBody},
+		{"parse error", &parseError{err: errors.New("unexpected end of JSON input")}, reasonParseError},
+		{"other errno", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.EHOSTUNREACH}, reasonOther},
+		{"other", errors.New("something went wrong"), reasonOther},
+	}
+
+	for _, test := range tests {
+		if got := failureReason(test.err); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestFailureReasonDial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = net.Dial("tcp", addr)
+	if err == nil {
+		t.Skip("the closed port accepted a connection")
+	}
+	if reason := failureReason(err); reason != reasonConnectionRefused {
+		t.Errorf("expected %s, got %s for %v", reasonConnectionRefused, reason, err)
+	}
+
+	_, err = net.Dial("unix", "/nonexistent/php-fpm.sock")
+	if reason := failureReason(err); reason != reasonSocketMissing {
+		t.Errorf("expected %s, got %s for %v", reasonSocketMissing, reason, err)
+	}
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// flamegraph layout, in pixels.
+const (
+	flamegraphWidth       = 1200
+	flamegraphFrameHeight = 16
+	flamegraphPadding     = 10
+	flamegraphTitleHeight = 30
+	// flamegraphCharWidth is the approximate width of a character of the
+	// frame labels, used to truncate them.
+	flamegraphCharWidth = 7
+)
+
+// flameNode is a frame of a flamegraph with the frames called from it.
+type flameNode struct {
+	name     string
+	value    int
+	children map[string]*flameNode
+}
+
+// buildFlameTree merges folded stacks into a tree rooted at a node for all
+// stacks.
+func buildFlameTree(counts map[string]int) *flameNode {
+	root := &flameNode{name: "all", children: map[string]*flameNode{}}
+	for stack, n := range counts {
+		node := root
+		node.value += n
+		for _, frame := range strings.Split(stack, ";") {
+			child, ok := node.children[frame]
+			if !ok {
+				child = &flameNode{name: frame, children: map[string]*flameNode{}}
+				node.children[frame] = child
+			}
+			child.value += n
+			node = child
+		}
+	}
+	return root
+}
+
+// depth returns the number of levels of the tree below and including n.
+func (n *flameNode) depth() int {
+	max := 0
+	for _, child := range n.children {
+		if d := child.depth(); d > max {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// writeFlamegraph renders folded stacks as an SVG flamegraph, with the
+// root at the bottom and frames sorted by name like flamegraph.pl.
+func writeFlamegraph(w io.Writer, title string, counts map[string]int) {
+	root := buildFlameTree(counts)
+	depth := root.depth()
+	height := flamegraphTitleHeight + depth*flamegraphFrameHeight + flamegraphPadding
+
+	fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg" font-family="Verdana" font-size="12">
+<rect x="0" y="0" width="%d" height="%d" fill="#eeeeee"/>
+<text x="%d" y="20" text-anchor="middle" font-size="16">%s</text>
+`, flamegraphWidth, height, flamegraphWidth, height, flamegraphWidth/2, html.EscapeString(title))
+
+	if root.value > 0 {
+		scale := float64(flamegraphWidth-2*flamegraphPadding) / float64(root.value)
+		bottom := height - flamegraphPadding - flamegraphFrameHeight
+		writeFlameNode(w, root, root.value, flamegraphPadding, bottom, scale)
+	}
+
+	fmt.Fprintln(w, "</svg>")
+}
+
+func writeFlameNode(w io.Writer, n *flameNode, total int, x float64, y int, scale float64) {
+	width := float64(n.value) * scale
+	if width < 0.1 {
+		return
+	}
+
+	label := fmt.Sprintf("%s (%d samples, %.2f%%)", n.name, n.value, 100*float64(n.value)/float64(total))
+	fmt.Fprintf(w, `<g><title>%s</title><rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" rx="2" ry="2"/>`,
+		html.EscapeString(label), x, y, width, flamegraphFrameHeight-1, flameColor(n.name))
+
+	if chars := int(width/flamegraphCharWidth) - 1; chars >= 3 {
+		text := n.name
+		if r := []rune(text); len(r) > chars {
+			text = string(r[:chars-2]) + ".."
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%d">%s</text>`, x+3, y+flamegraphFrameHeight-4, html.EscapeString(text))
+	}
+	fmt.Fprintln(w, "</g>")
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := n.children[name]
+		writeFlameNode(w, child, total, x, y-flamegraphFrameHeight, scale)
+		x += float64(child.value) * scale
+	}
+}
+
+// flameColor returns a warm color for a frame, derived from its name so it
+// is stable between renders.
+func flameColor(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, (v>>8)%230, (v>>16)%55)
+}
@@ -5,9 +5,13 @@ go 1.12
 require (
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/procfs v0.6.0
 	github.com/tomasen/fcgi_client v0.0.0-20171212193905-d32b71631a94
-	go.uber.org/atomic v1.3.1 // indirect
+	go.uber.org/atomic v1.3.1
 	go.uber.org/zap v1.4.1
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.4.0
 )
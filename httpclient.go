@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// httpClientConfig configures how the status page of an HTTP target is fetched.
+type httpClientConfig struct {
+	TLSConfig clientTLSConfig  `yaml:"tls_config"`
+	BasicAuth *basicAuthConfig `yaml:"basic_auth"`
+	// BearerTokenFile is read on every request so the token can be rotated.
+	BearerTokenFile string `yaml:"bearer_token_file"`
+	// Headers are added to every request.
+	Headers map[string]string `yaml:"headers"`
+	// Host overrides the Host header sent to the server.
+	Host string `yaml:"host"`
+	// ProxyURL is the proxy to use. If unset, the proxy is taken from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string `yaml:"proxy_url"`
+}
+
+type clientTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type basicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// PasswordFile is read on every request so the password can be rotated.
+	PasswordFile string `yaml:"password_file"`
+}
+
+// idleConnTimeout is how long a connection to a target is kept open
+// between scrapes.
+const idleConnTimeout = 90 * time.Second
+
+// newHTTPClient creates the client used to fetch the status page.
+func newHTTPClient(c *httpClientConfig, dialTimeout time.Duration, readTimeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := newClientTLSConfig(&c.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse proxy_url")
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	if c.BasicAuth != nil && c.BasicAuth.Password != "" && c.BasicAuth.PasswordFile != "" {
+		return nil, errors.New("at most one of basic_auth password and password_file may be set")
+	}
+	if c.BasicAuth != nil && c.BearerTokenFile != "" {
+		return nil, errors.New("at most one of basic_auth and bearer_token_file may be set")
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout: dialTimeout,
+			}).DialContext,
+			TLSClientConfig:       tlsConfig,
+			ResponseHeaderTimeout: readTimeout,
+			IdleConnTimeout:       idleConnTimeout,
+		},
+		// redirects are not followed, as they could lead probes to hosts
+		// that are not allowed. A redirect is reported as a bad status.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+func newClientTLSConfig(c *clientTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read ca_file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// prepareRequest adds the configured headers and credentials to a request.
+func (c *httpClientConfig) prepareRequest(req *http.Request) error {
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if c.Host != "" {
+		req.Host = c.Host
+	}
+
+	if c.BasicAuth != nil {
+		password := c.BasicAuth.Password
+		if c.BasicAuth.PasswordFile != "" {
+			data, err := ioutil.ReadFile(c.BasicAuth.PasswordFile)
+			if err != nil {
+				return errors.Wrap(err, "failed to read password_file")
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		req.SetBasicAuth(c.BasicAuth.Username, password)
+	}
+
+	if c.BearerTokenFile != "" {
+		data, err := ioutil.ReadFile(c.BearerTokenFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read bearer_token_file")
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(data)))
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherLabelValue replaces label values once a limiter is full.
+const otherLabelValue = "other"
+
+// placeholders replace path segments that look like identifiers.
+const (
+	numericPlaceholder = ":id"
+	uuidPlaceholder    = ":uuid"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// labelRule rewrites request URIs and scripts before they are used as label
+// values.
+type labelRule struct {
+	// Match is a regular expression. Every match is replaced.
+	Match string `yaml:"match"`
+	// Replacement may refer to capture groups as $1 or ${name}.
+	Replacement string `yaml:"replacement"`
+}
+
+type compiledLabelRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// pathNormalizer groups request URIs and scripts that differ only by query
+// string or identifiers into a single label value.
+type pathNormalizer struct {
+	rules []compiledLabelRule
+}
+
+// normalize strips the query string of a path, applies the rewrite rules in
+// order and collapses numeric and UUID path segments.
+func (n *pathNormalizer) normalize(v string) string {
+	if i := strings.IndexAny(v, "?#"); i >= 0 {
+		v = v[:i]
+	}
+
+	for _, rule := range n.rules {
+		v = rule.re.ReplaceAllString(v, rule.replacement)
+	}
+
+	segments := strings.Split(v, "/")
+	for i, segment := range segments {
+		switch {
+		case numericSegment.MatchString(segment):
+			segments[i] = numericPlaceholder
+		case uuidSegment.MatchString(segment):
+			segments[i] = uuidPlaceholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// AddLabelRule creates a function that will add a rule rewriting request URIs
+// and scripts before they are used as label values. Rules are applied in the
+// order they are added.
+// Generally only used when create a new Exporter.
+func AddLabelRule(match string, replacement string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return errors.Wrapf(err, "invalid label rule %q", match)
+		}
+		e.paths.rules = append(e.paths.rules, compiledLabelRule{
+			re:          re,
+			replacement: replacement,
+		})
+		return nil
+	}
+}
+
+// requestScript returns the script of a request, or its URI if the script
+// is not known.
+func requestScript(script string, uri string) string {
+	if script == "" || script == "-" {
+		return uri
+	}
+	return script
+}
+
+func newDroppedLabelCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "label_values_dropped_total",
+		Help:      "Number of label values replaced by other because the limit of distinct values was reached",
+	}, []string{"target", "source", "label"})
+}
+
+// labelLimiter caps the number of distinct values of a label, so a noisy
+// application cannot create an unbounded number of series.
+type labelLimiter struct {
+	max int
+	// paths normalizes values before they are counted. It is nil for labels
+	// that are not request URIs or scripts.
+	paths *pathNormalizer
+	// dropped counts values replaced by otherLabelValue, by droppedLabels.
+	dropped       *prometheus.CounterVec
+	droppedLabels []string
+	mu            sync.Mutex
+	values        map[string]struct{}
+}
+
+// newLabelLimiter creates a limiter for a label of a target. Values replaced
+// by otherLabelValue are counted by source and label.
+func (e *Exporter) newLabelLimiter(target string, source string, label string) *labelLimiter {
+	return &labelLimiter{
+		max:           e.maxLabelValues,
+		dropped:       e.droppedLabelValues,
+		droppedLabels: []string{target, source, label},
+		values:        map[string]struct{}{},
+	}
+}
+
+// newPathLabelLimiter creates a limiter for a request URI or script label,
+// which normalizes values before limiting them.
+func (e *Exporter) newPathLabelLimiter(target string, source string, label string) *labelLimiter {
+	l := e.newLabelLimiter(target, source, label)
+	l.paths = &e.paths
+	return l
+}
+
+// value returns v, normalized if it is a path, if it has been seen before or
+// there is room for another value, and otherLabelValue if not.
+func (l *labelLimiter) value(v string) string {
+	if l.paths != nil {
+		v = l.paths.normalize(v)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.values[v]; ok {
+		return v
+	}
+	if len(l.values) >= l.max {
+		l.dropped.WithLabelValues(l.droppedLabels...).Inc()
+		return otherLabelValue
+	}
+	l.values[v] = struct{}{}
+	return v
+}
@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestPathNormalizer(t *testing.T) {
+	e, err := New(
+		SetLogger(zap.NewNop()),
+		AddLabelRule(`^/api/v[0-9]+/`, "/api/"),
+		AddLabelRule(`^/users/([0-9]+)/avatar\.png$`, "/avatars/$1"),
+		AddLabelRule(`page=[0-9]+`, "page"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"/index.php", "/index.php"},
+		{"/index.php?id=3", "/index.php"},
+		{"/index.php#top", "/index.php"},
+		// the query string is stripped before the rules see it.
+		{"/list?page=2", "/list"},
+		{"/api/v2/orders", "/api/orders"},
+		// rules are applied before segments are collapsed.
+		{"/users/42/avatar.png", "/avatars/:id"},
+		{"/users/42/orders/7", "/users/:id/orders/:id"},
+		{"/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301", "/orders/:uuid"},
+		{"/orders/3F2504E0-4F89-11D3-9A0C-0305E82C3301/items", "/orders/:uuid/items"},
+		{"/orders/3f2504e0-4f89-11d3-9a0c", "/orders/3f2504e0-4f89-11d3-9a0c"},
+		{"/v2/42abc/2019-10", "/v2/42abc/2019-10"},
+		{"/var/www/42/index.php", "/var/www/:id/index.php"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := e.paths.normalize(test.value); got != test.expected {
+			t.Errorf("normalize(%q): expected %q, got %q", test.value, test.expected, got)
+		}
+	}
+}
+
+func TestAddLabelRuleInvalid(t *testing.T) {
+	if _, err := New(SetLogger(zap.NewNop()), AddLabelRule(`(`, "")); err == nil {
+		t.Error("expected an invalid rule to be rejected")
+	}
+}
+
+func TestRequestScript(t *testing.T) {
+	tests := []struct {
+		script   string
+		uri      string
+		expected string
+	}{
+		{"/var/www/index.php", "/index.php", "/var/www/index.php"},
+		{"-", "/index.php", "/index.php"},
+		{"", "/index.php", "/index.php"},
+	}
+
+	for _, test := range tests {
+		if got := requestScript(test.script, test.uri); got != test.expected {
+			t.Errorf("requestScript(%q, %q): expected %q, got %q", test.script, test.uri, test.expected, got)
+		}
+	}
+}
+
+func TestLabelLimiter(t *testing.T) {
+	e, err := New(SetLogger(zap.NewNop()), SetMaxLabelValues(2))
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	scripts := e.newPathLabelLimiter("www", "access_log", "script")
+	methods := e.newLabelLimiter("www", "access_log", "method")
+
+	tests := []struct {
+		limiter  *labelLimiter
+		value    string
+		expected string
+	}{
+		{scripts, "/users/1", "/users/:id"},
+		// normalized values count once.
+		{scripts, "/users/2?page=3", "/users/:id"},
+		{scripts, "/index.php", "/index.php"},
+		{scripts, "/about.php", otherLabelValue},
+		{scripts, "/contact.php", otherLabelValue},
+		// values seen before the limit was reached are kept.
+		{scripts, "/index.php", "/index.php"},
+		{methods, "GET", "GET"},
+		{methods, "POST", "POST"},
+		{methods, "/users/1", otherLabelValue},
+	}
+
+	for _, test := range tests {
+		if got := test.limiter.value(test.value); got != test.expected {
+			t.Errorf("value(%q): expected %q, got %q", test.value, test.expected, got)
+		}
+	}
+
+	expected := map[string]float64{
+		"script": 2,
+		"method": 1,
+	}
+	for label, value := range expected {
+		got := counterValue(t, e.registry, "phpfpm_label_values_dropped_total", map[string]string{
+			"target": "www",
+			"source": "access_log",
+			"label":  label,
+		})
+		if got != value {
+			t.Errorf("expected %v dropped %s values, got %v", value, label, got)
+		}
+	}
+}
+
+// counterValue returns the value of the counter with the given name and
+// labels gathered from g, or -1 if it is not found.
+func counterValue(t *testing.T, g prometheus.Gatherer, name string, labels map[string]string) float64 {
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if labels[pair.GetName()] != pair.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return -1
+}
@@ -0,0 +1,76 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// pingConfig configures the check of a pool's ping.path.
+type pingConfig struct {
+	// Path is the ping.path of the pool. The check is disabled if unset.
+	Path string `yaml:"path"`
+	// Response is the ping.response of the pool. It defaults to pong.
+	Response string `yaml:"response"`
+	// Timeout limits the check. It is separate from the timeout of the
+	// status request, so the check still ends when the status page hangs,
+	// but the check never outlasts the scrape.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// defaultPingTimeout is the timeout of ping checks if none is configured.
+const defaultPingTimeout = time.Second
+
+// pingResult is the result of a single ping check.
+type pingResult struct {
+	up bool
+}
+
+// newPingHistogram creates the histogram of ping latencies for a target.
+func newPingHistogram(target string) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace:   "phpfpm",
+		Name:        "ping_duration_seconds",
+		Help:        "Latency of successful ping checks",
+		Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 14),
+		ConstLabels: prometheus.Labels{"target": target},
+	})
+}
+
+// ping requests the ping.path of a target and checks the response. It
+// ends at the ping timeout or at the deadline of ctx, whichever is first.
+func (e *Exporter) ping(ctx context.Context, t *target) *pingResult {
+	response := t.Ping.Response
+	if response == "" {
+		response = "pong"
+	}
+	timeout := t.Ping.Timeout
+	if timeout == 0 {
+		timeout = defaultPingTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	body, err := getData(ctx, t, t.Ping.Path, "", nil)
+	duration := time.Since(start)
+
+	if err == nil && strings.TrimSpace(string(body)) != response {
+		err = errors.Errorf("unexpected ping response %q", body)
+	}
+	if err != nil {
+		e.logger.Error("failed to ping php-fpm",
+			zap.String("target", t.Name),
+			zap.Error(err),
+		)
+		return &pingResult{}
+	}
+
+	t.pingDuration.Observe(duration.Seconds())
+	return &pingResult{up: true}
+}
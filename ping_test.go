@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			w.Write([]byte("pong\n"))
+		case "/slow-ping":
+			<-release
+		default:
+			w.Write([]byte(jsonStatus))
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		path    string
+		timeout time.Duration
+		up      bool
+	}{
+		{"up", "/ping", 0, true},
+		{"ping timeout", "/slow-ping", 100 * time.Millisecond, false},
+		// the scrape gives up before the ping timeout.
+		{"scrape timeout", "/slow-ping", time.Hour, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, target := newTestTarget(t, srv.URL+"/status")
+			target.Ping = pingConfig{Path: test.path, Timeout: test.timeout}
+			target.pingDuration = newPingHistogram(target.Name)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			s := e.scrape(ctx, target)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the scrape to end within its timeout, took %v", elapsed)
+			}
+			if s.ping == nil {
+				t.Fatal("expected a ping result")
+			}
+			if s.ping.up != test.up {
+				t.Errorf("expected ping up %v, got %v", test.up, s.ping.up)
+			}
+		})
+	}
+}
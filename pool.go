@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// poolLimits are the process manager limits configured for a pool.
+// Zero means unknown.
+type poolLimits struct {
+	MaxChildren     int64 `yaml:"max_children"`
+	StartServers    int64 `yaml:"start_servers"`
+	MinSpareServers int64 `yaml:"min_spare_servers"`
+	MaxSpareServers int64 `yaml:"max_spare_servers"`
+}
+
+// merge returns the limits with any unknown values taken from other.
+func (l poolLimits) merge(other poolLimits) poolLimits {
+	if l.MaxChildren == 0 {
+		l.MaxChildren = other.MaxChildren
+	}
+	if l.StartServers == 0 {
+		l.StartServers = other.StartServers
+	}
+	if l.MinSpareServers == 0 {
+		l.MinSpareServers = other.MinSpareServers
+	}
+	if l.MaxSpareServers == 0 {
+		l.MaxSpareServers = other.MaxSpareServers
+	}
+	return l
+}
+
+// poolConfigMaxDepth limits how deeply include directives are followed.
+const poolConfigMaxDepth = 8
+
+// readPoolLimits reads the limits of each pool from a php-fpm configuration
+// file, following include directives.
+func readPoolLimits(filename string) (map[string]poolLimits, error) {
+	pools := map[string]poolLimits{}
+	if err := readPoolConfig(filename, pools, 0); err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+func readPoolConfig(filename string, pools map[string]poolLimits, depth int) error {
+	if depth > poolConfigMaxDepth {
+		return errors.Errorf("too many nested includes in %s", filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to open pool config")
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := pools[section]; !ok && section != "global" {
+				pools[section] = poolLimits{}
+			}
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := iniValue(line[i+1:])
+
+		if key == "include" {
+			pattern := value
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(filename), pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return errors.Wrapf(err, "invalid include %q", value)
+			}
+			for _, m := range matches {
+				if err := readPoolConfig(m, pools, depth+1); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if section == "" || section == "global" {
+			continue
+		}
+
+		var field *int64
+		l := pools[section]
+		switch key {
+		case "pm.max_children":
+			field = &l.MaxChildren
+		case "pm.start_servers":
+			field = &l.StartServers
+		case "pm.min_spare_servers":
+			field = &l.MinSpareServers
+		case "pm.max_spare_servers":
+			field = &l.MaxSpareServers
+		default:
+			continue
+		}
+
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for %s in pool %s", key, section)
+		}
+		*field = v
+		pools[section] = l
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read pool config")
+	}
+
+	return nil
+}
+
+// iniValue returns the value of an ini directive without its quotes or
+// trailing ; comment.
+func iniValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+		if end := strings.IndexByte(raw[1:], raw[0]); end >= 0 {
+			return raw[1 : end+1]
+		}
+	}
+	if i := strings.IndexByte(raw, ';'); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.Trim(strings.TrimSpace(raw), `"'`)
+}
+
+// limits returns the configured limits of the target's pool. Limits set in
+// the target configuration take precedence over those read from the pool
+// configuration file.
+func (t *target) limits(pool string) (poolLimits, error) {
+	if t.PoolConfigFile == "" {
+		return t.Limits, nil
+	}
+
+	pools, err := readPoolLimits(t.PoolConfigFile)
+	if err != nil {
+		return t.Limits, err
+	}
+
+	name := t.PoolName
+	if name == "" {
+		name = pool
+	}
+
+	fileLimits, ok := pools[name]
+	if !ok && len(pools) == 1 {
+		for _, l := range pools {
+			fileLimits = l
+		}
+	}
+
+	return t.Limits.merge(fileLimits), nil
+}
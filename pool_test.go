@@ -0,0 +1,133 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const fpmConf = `;;;;;;;;;;;;;;;;;;;;;
+; FPM Configuration ;
+;;;;;;;;;;;;;;;;;;;;;
+
+[global]
+pid = /run/php/php7.2-fpm.pid
+error_log = /var/log/php7.2-fpm.log
+; pm.max_children in the global section is ignored
+pm.max_children = 1
+
+include=pool.d/*.conf
+`
+
+const wwwConf = `[www]
+user = www-data
+group = www-data
+listen = /run/php/php7.2-fpm.sock
+pm = dynamic
+pm.max_children = 50 ; the most workers the host can fit
+pm.start_servers = "5"
+pm.min_spare_servers = '2'
+;pm.max_spare_servers = 100
+pm.max_spare_servers = 10
+`
+
+const apiConf = `[api]
+listen = 127.0.0.1:9001
+pm = static
+pm.max_children = 8
+`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "php-fpm-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadPoolLimits(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"php-fpm.conf":     fpmConf,
+		"pool.d/www.conf":  wwwConf,
+		"pool.d/api.conf":  apiConf,
+		"pool.d/README.md": "pm.max_children = 3",
+	})
+	defer os.RemoveAll(dir)
+
+	pools, err := readPoolLimits(filepath.Join(dir, "php-fpm.conf"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]poolLimits{
+		"www": {MaxChildren: 50, StartServers: 5, MinSpareServers: 2, MaxSpareServers: 10},
+		"api": {MaxChildren: 8},
+	}
+	if !reflect.DeepEqual(pools, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pools)
+	}
+}
+
+func TestReadPoolLimitsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"missing", map[string]string{}},
+		{"invalid value", map[string]string{"php-fpm.conf": "[www]\npm.max_children = many\n"}},
+		{"include loop", map[string]string{"php-fpm.conf": "include = php-fpm.conf\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeFiles(t, test.files)
+			defer os.RemoveAll(dir)
+
+			if _, err := readPoolLimits(filepath.Join(dir, "php-fpm.conf")); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestIniValue(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{" 50", "50"},
+		{" 50 ; comment", "50"},
+		{"50;comment", "50"},
+		{` "5"`, "5"},
+		{` '5' ; comment`, "5"},
+		{` "a;b" ; comment`, "a;b"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := iniValue(test.raw); got != test.expected {
+			t.Errorf("iniValue(%q): expected %q, got %q", test.raw, test.expected, got)
+		}
+	}
+}
+
+func TestPoolLimitsMerge(t *testing.T) {
+	configured := poolLimits{MaxChildren: 20}
+	file := poolLimits{MaxChildren: 50, StartServers: 5}
+
+	expected := poolLimits{MaxChildren: 20, StartServers: 5}
+	if got := configured.merge(file); got != expected {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SetProbeAllow creates a function that will set the patterns a target passed
+// to /probe must match. Patterns are regular expressions that must match the
+// whole target. If no patterns are set, all probes are rejected.
+// Generally only used when create a new Exporter.
+func SetProbeAllow(patterns []string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		for _, p := range patterns {
+			r, err := regexp.Compile("^(?:" + p + ")$")
+			if err != nil {
+				return errors.Wrapf(err, "invalid probe pattern %q", p)
+			}
+			e.probeAllow = append(e.probeAllow, r)
+		}
+		return nil
+	}
+}
+
+// probeAllowed returns whether the target may be probed.
+func (e *Exporter) probeAllowed(rawurl string) bool {
+	for _, r := range e.probeAllow {
+		if r.MatchString(rawurl) {
+			return true
+		}
+	}
+	return false
+}
+
+// probe scrapes the target given in the query string on demand.
+func (e *Exporter) probe(w http.ResponseWriter, r *http.Request) {
+	rawurl := r.URL.Query().Get("target")
+	if rawurl == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	if !e.probeAllowed(rawurl) {
+		e.logger.Warn("probe target not allowed", zap.String("target", rawurl))
+		http.Error(w, "target is not allowed", http.StatusForbidden)
+		return
+	}
+
+	t, err := newTarget(targetConfig{Name: rawurl, URL: rawurl})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := e.prepareTarget(t); err != nil {
+		e.logger.Error("failed to prepare probe target", zap.String("target", rawurl), zap.Error(err))
+		http.Error(w, "failed to prepare target", http.StatusInternalServerError)
+		return
+	}
+	// probes are always scraped on demand.
+	t.ScrapeInterval = 0
+
+	e.serveTargets(w, r, []*target{t})
+	// the target is not reused, so its connections are not either.
+	t.client.CloseIdleConnections()
+}
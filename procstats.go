@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/procfs"
+)
+
+// userHZ is the number of clock ticks per second procfs assumes when
+// reporting CPU times.
+const userHZ = 100
+
+// processTotals are the resources used by one or more processes.
+type processTotals struct {
+	processes       int
+	residentMemory  float64
+	cpuSeconds      float64
+	openFDs         float64
+	threads         float64
+	contextSwitches float64
+	// pss and private are only read for processes the exporter may
+	// inspect, counted by smapsRead.
+	smapsRead  int
+	pss        float64
+	private    float64
+	maxPrivate float64
+}
+
+// add adds the resources used by a process to the totals. Open file
+// descriptors and memory details are skipped if the exporter may not read
+// them.
+func (p *processTotals) add(proc procfs.Proc, stat procfs.ProcStat) {
+	p.processes++
+	p.residentMemory += float64(stat.ResidentMemory())
+	p.cpuSeconds += stat.CPUTime()
+	p.threads += float64(stat.NumThreads)
+
+	if smaps, err := proc.ProcSMapsRollup(); err == nil {
+		private := float64(smaps.PrivateClean + smaps.PrivateDirty)
+		p.smapsRead++
+		p.pss += float64(smaps.Pss)
+		p.private += private
+		if private > p.maxPrivate {
+			p.maxPrivate = private
+		}
+	}
+
+	if fds, err := proc.FileDescriptorsLen(); err == nil {
+		p.openFDs += float64(fds)
+	}
+	if status, err := proc.NewStatus(); err == nil {
+		p.contextSwitches += float64(status.TotalCtxtSwitches())
+	}
+}
+
+// poolProcesses are the resources used by the master and workers of a pool.
+type poolProcesses struct {
+	master  processTotals
+	workers processTotals
+	// masterStartTime is the unix time the master was started.
+	masterStartTime float64
+	// memoryLimit is the memory available to the pool, the smaller of the
+	// master's cgroup memory limit and the memory of the host. It is zero if
+	// it could not be read, and memoryLimitErr is set.
+	memoryLimit    float64
+	memoryLimitErr error
+}
+
+// masterPid returns the pid of the target's php-fpm master, from the pid
+// file if one is set. The pid file is read every time, so a restarted
+// master is picked up.
+func (t *target) masterPid() (int, error) {
+	if t.PidFile == "" {
+		return t.Pid, nil
+	}
+
+	data, err := ioutil.ReadFile(t.PidFile)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read pid file")
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid pid in %s", t.PidFile)
+	}
+	return pid, nil
+}
+
+// poolProcesses reads the resources used by the master of a target and its
+// workers, the master's child processes, from procfs.
+func (e *Exporter) poolProcesses(t *target) (*poolProcesses, error) {
+	pid, err := t.masterPid()
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := procfs.NewFS(e.procPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open procfs")
+	}
+
+	master, err := fs.Proc(pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find master process %d", pid)
+	}
+	masterStat, err := master.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read master process %d", pid)
+	}
+	startTime, err := masterStat.StartTime()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read master start time")
+	}
+
+	// the memory limit is only needed for capacity planning, so failing to
+	// read it does not hide the other resources.
+	memoryLimit, memoryLimitErr := readMemoryLimit(e.procPath, e.sysPath, pid)
+
+	p := &poolProcesses{
+		masterStartTime: startTime,
+		memoryLimit:     memoryLimit,
+		memoryLimitErr:  memoryLimitErr,
+	}
+	p.master.add(master, masterStat)
+
+	// the CPU time of workers that have exited is added to the master's
+	// children times once they are reaped, so including it keeps the
+	// workers' total from dropping when workers are recycled.
+	p.workers.cpuSeconds = float64(masterStat.CUTime+masterStat.CSTime) / userHZ
+
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list processes")
+	}
+	for _, proc := range procs {
+		stat, err := proc.Stat()
+		if err != nil || stat.PPID != pid {
+			// the process may have exited since listing them.
+			continue
+		}
+		p.workers.add(proc, stat)
+	}
+
+	return p, nil
+}
+
+// uptime returns how long the master has been running.
+func (p *poolProcesses) uptime(now time.Time) float64 {
+	return float64(now.UnixNano())/1e9 - p.masterStartTime
+}
@@ -0,0 +1,168 @@
+package exporter
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// slowlogTimeLayout is the format of the timestamp of a slowlog entry.
+const slowlogTimeLayout = "02-Jan-2006 15:04:05"
+
+var (
+	// slowlogHeader matches the first line of an entry, such as
+	// [21-Oct-2026 10:20:30]  [pool www] pid 12345
+	slowlogHeader = regexp.MustCompile(`^\[([^\]]+)\]\s+\[pool ([^\]]+)\] pid (\d+)$`)
+	// slowlogFrame matches a stack frame, such as
+	// [0x00007f5e2e8130a8] sleep() /var/www/index.php:12
+	slowlogFrame = regexp.MustCompile(`^\[0x[0-9a-fA-F]+\] (\S+) (.+):(\d+)$`)
+)
+
+// stackFrame is a frame of a slowlog stack trace.
+type stackFrame struct {
+	function string
+	file     string
+	line     int
+}
+
+// slowlogEntry is a single request logged to the slowlog.
+type slowlogEntry struct {
+	time   time.Time
+	pool   string
+	pid    int
+	script string
+	// frames is the stack trace, innermost frame first.
+	frames []stackFrame
+}
+
+// slowlogParser assembles slowlog entries from lines of the log.
+//
+// php-fpm writes a blank line before each entry and nothing after it, so
+// an entry is only known to be complete when the next one starts. The last
+// entry is returned by flush once the log has been idle.
+type slowlogParser struct {
+	entry *slowlogEntry
+}
+
+// flush returns the entry being assembled, if any.
+func (p *slowlogParser) flush() *slowlogEntry {
+	done := p.entry
+	p.entry = nil
+	return done
+}
+
+// line parses a line of the slowlog. It returns the previous entry once a
+// new one starts.
+func (p *slowlogParser) line(line string) *slowlogEntry {
+	line = strings.TrimSpace(line)
+
+	if m := slowlogHeader.FindStringSubmatch(line); m != nil {
+		done := p.entry
+		p.entry = &slowlogEntry{pool: m[2]}
+		p.entry.time, _ = time.ParseInLocation(slowlogTimeLayout, m[1], time.Local)
+		p.entry.pid, _ = strconv.Atoi(m[3])
+		return done
+	}
+
+	if p.entry == nil {
+		return nil
+	}
+
+	if line == "" {
+		return p.flush()
+	}
+
+	if strings.HasPrefix(line, "script_filename = ") {
+		p.entry.script = strings.TrimPrefix(line, "script_filename = ")
+		return nil
+	}
+
+	if m := slowlogFrame.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		p.entry.frames = append(p.entry.frames, stackFrame{
+			function: m[1],
+			file:     m[2],
+			line:     n,
+		})
+	}
+
+	return nil
+}
+
+// slowlogMetrics count the slowlog entries of a target.
+type slowlogMetrics struct {
+	entries   *prometheus.CounterVec
+	topFrames *prometheus.CounterVec
+	scripts   *labelLimiter
+	frames    *labelLimiter
+}
+
+func newSlowlogMetrics(target string, scripts *labelLimiter, frames *labelLimiter) *slowlogMetrics {
+	return &slowlogMetrics{
+		entries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "slowlog_entries_total",
+			Help:        "Number of requests written to the slowlog by script",
+			ConstLabels: prometheus.Labels{"target": target},
+		}, []string{"script"}),
+		topFrames: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "slowlog_top_frames_total",
+			Help:        "Number of requests written to the slowlog by the innermost frame of their stack trace",
+			ConstLabels: prometheus.Labels{"target": target},
+		}, []string{"function", "location"}),
+		scripts: scripts,
+		frames:  frames,
+	}
+}
+
+func (m *slowlogMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.entries.Describe(ch)
+	m.topFrames.Describe(ch)
+}
+
+func (m *slowlogMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.entries.Collect(ch)
+	m.topFrames.Collect(ch)
+}
+
+// observe counts a slowlog entry.
+func (m *slowlogMetrics) observe(entry *slowlogEntry) {
+	m.entries.WithLabelValues(m.scripts.value(entry.script)).Inc()
+
+	if len(entry.frames) == 0 {
+		return
+	}
+	top := entry.frames[0]
+	location := top.file + ":" + strconv.Itoa(top.line)
+	if m.frames.value(top.function+" "+location) == otherLabelValue {
+		m.topFrames.WithLabelValues(otherLabelValue, otherLabelValue).Inc()
+		return
+	}
+	m.topFrames.WithLabelValues(top.function, location).Inc()
+}
+
+// tailSlowlog follows the slowlog of a target until the context is
+// canceled.
+func (e *Exporter) tailSlowlog(ctx context.Context, t *target) {
+	var parser slowlogParser
+	observe := func(entry *slowlogEntry) {
+		if entry != nil {
+			t.slowlog.observe(entry)
+			t.stacks.add(time.Now(), entry)
+		}
+	}
+
+	tl := newTailer(t.Slowlog, e.logger.With(zap.String("target", t.Name)))
+	tl.idle = func() {
+		observe(parser.flush())
+	}
+	tl.run(ctx, func(line string) {
+		observe(parser.line(line))
+	})
+}
@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// php-fpm writes a blank line before each entry and nothing after it.
+const slowlogEntries = `
+[21-Oct-2019 10:20:30]  [pool www] pid 12345
+script_filename = /var/www/index.php
+[0x00007f5e2e8130a8] sleep() /var/www/lib/db.php:12
+[0x00007f5e2e813020] query() /var/www/lib/db.php:40
+[0x00007f5e2e812f80] main() /var/www/index.php:7
+
+[21-Oct-2019 10:20:35]  [pool api] pid 12346
+script_filename = /var/www/api.php
+[0x00007f5e2e8130a8] curl_exec() /var/www/api.php:3`
+
+var expectedSlowlogEntries = []*slowlogEntry{
+	{
+		time:   time.Date(2019, 10, 21, 10, 20, 30, 0, time.Local),
+		pool:   "www",
+		pid:    12345,
+		script: "/var/www/index.php",
+		frames: []stackFrame{
+			{function: "sleep()", file: "/var/www/lib/db.php", line: 12},
+			{function: "query()", file: "/var/www/lib/db.php", line: 40},
+			{function: "main()", file: "/var/www/index.php", line: 7},
+		},
+	},
+	{
+		time:   time.Date(2019, 10, 21, 10, 20, 35, 0, time.Local),
+		pool:   "api",
+		pid:    12346,
+		script: "/var/www/api.php",
+		frames: []stackFrame{
+			{function: "curl_exec()", file: "/var/www/api.php", line: 3},
+		},
+	},
+}
+
+func TestSlowlogParser(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		// entries are those returned by line, and flushed by those returned
+		// by flush once the log is idle.
+		entries []*slowlogEntry
+		flushed *slowlogEntry
+	}{
+		{
+			name:    "single entry",
+			log:     slowlogEntries[:strings.Index(slowlogEntries, "\n\n")],
+			flushed: expectedSlowlogEntries[0],
+		},
+		{
+			name:    "two entries",
+			log:     slowlogEntries,
+			entries: expectedSlowlogEntries[:1],
+			flushed: expectedSlowlogEntries[1],
+		},
+		{
+			name: "lines before the first entry",
+			log:  "script_filename = /var/www/index.php\n[0x00007f5e2e8130a8] sleep() /var/www/index.php:3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				parser  slowlogParser
+				entries []*slowlogEntry
+			)
+			for _, line := range strings.Split(test.log, "\n") {
+				if entry := parser.line(line); entry != nil {
+					entries = append(entries, entry)
+				}
+			}
+
+			if !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("expected entries %+v, got %+v", test.entries, entries)
+			}
+			if flushed := parser.flush(); !reflect.DeepEqual(flushed, test.flushed) {
+				t.Errorf("expected flushed entry %+v, got %+v", test.flushed, flushed)
+			}
+			if entry := parser.flush(); entry != nil {
+				t.Errorf("expected nothing to flush, got %+v", entry)
+			}
+		})
+	}
+}
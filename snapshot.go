@@ -0,0 +1,321 @@
+package exporter
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// snapshot is the result of a single scrape of a target.
+type snapshot struct {
+	time    time.Time
+	status  *poolStatus
+	derived derivedStatus
+	err     error
+	// ping is the result of the ping check, if it is configured.
+	ping *pingResult
+}
+
+// inflightFetch is a status request shared by concurrent scrapes of a target.
+type inflightFetch struct {
+	ctx  *fetchContext
+	done chan struct{}
+	// snapshot is set before done is closed.
+	snapshot *snapshot
+}
+
+// fetchMargin is how long before the deadline of the scrapes waiting for it a
+// shared request ends, so its result, even a timeout, reaches them.
+const fetchMargin = 50 * time.Millisecond
+
+// scrape returns the status of a target. Concurrent scrapes of the target
+// share a single request to php-fpm, which runs until the latest of their
+// deadlines, and the previous result is reused if it is more recent than the
+// target's minimum interval. Failures are counted once, by the shared request.
+func (e *Exporter) scrape(ctx context.Context, t *target) *snapshot {
+	deadline, ok := ctx.Deadline()
+	if timeout := t.timeout(0); !ok && timeout > 0 {
+		deadline, ok = time.Now().Add(timeout), true
+	}
+	deadline = deadline.Add(-fetchMargin)
+
+	t.mu.Lock()
+	if s := t.latest; s != nil && time.Since(s.time) < t.MinInterval {
+		t.mu.Unlock()
+		return s
+	}
+	f := t.inflight
+	if f == nil {
+		f = &inflightFetch{
+			ctx:  newFetchContext(deadline, ok),
+			done: make(chan struct{}),
+		}
+		t.inflight = f
+		go e.fetchShared(t, f)
+	} else {
+		f.ctx.extend(deadline, ok)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.snapshot
+	case <-ctx.Done():
+		return &snapshot{
+			time: time.Now(),
+			err:  errors.Wrap(ctx.Err(), "gave up waiting for php-fpm"),
+		}
+	}
+}
+
+// fetchShared runs a shared status request. It is not canceled when a
+// single scrape gives up.
+func (e *Exporter) fetchShared(t *target, f *inflightFetch) {
+	s := e.fetch(f.ctx, t)
+	f.ctx.cancel(context.Canceled)
+
+	t.mu.Lock()
+	t.inflight = nil
+	t.mu.Unlock()
+
+	f.snapshot = s
+	close(f.done)
+}
+
+// fetchContext is the context of a shared status request. Its deadline can
+// be extended by scrapes that join the request.
+type fetchContext struct {
+	context.Context
+	done chan struct{}
+
+	mu          sync.Mutex
+	deadline    time.Time
+	hasDeadline bool
+	timer       *time.Timer
+	err         error
+}
+
+func newFetchContext(deadline time.Time, hasDeadline bool) *fetchContext {
+	c := &fetchContext{
+		Context:     context.Background(),
+		done:        make(chan struct{}),
+		deadline:    deadline,
+		hasDeadline: hasDeadline,
+	}
+	if hasDeadline {
+		// the timer is set under the lock, as it may fire before AfterFunc
+		// returns.
+		c.mu.Lock()
+		c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+		c.mu.Unlock()
+	}
+	return c
+}
+
+func (c *fetchContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, c.hasDeadline
+}
+
+func (c *fetchContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *fetchContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// extend moves the deadline later, or removes it if hasDeadline is false.
+func (c *fetchContext) extend(deadline time.Time, hasDeadline bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.hasDeadline {
+		return
+	}
+	if !hasDeadline {
+		c.hasDeadline = false
+		c.timer.Stop()
+		return
+	}
+	if deadline.After(c.deadline) {
+		c.deadline = deadline
+	}
+}
+
+// expire ends the context if its deadline has passed, or waits for the
+// deadline if it was extended.
+func (c *fetchContext) expire() {
+	c.mu.Lock()
+	if !c.hasDeadline {
+		c.mu.Unlock()
+		return
+	}
+	if wait := time.Until(c.deadline); wait > 0 {
+		c.timer.Reset(wait)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.cancel(context.DeadlineExceeded)
+}
+
+func (c *fetchContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	close(c.done)
+}
+
+// fetch requests the status of a target and records the result.
+func (e *Exporter) fetch(ctx context.Context, t *target) *snapshot {
+	// the ping runs alongside the status request, so it does not add to the
+	// scrape's latency.
+	var ping chan *pingResult
+	if t.Ping.Path != "" {
+		ping = make(chan *pingResult, 1)
+		go func() {
+			ping <- e.ping(ctx, t)
+		}()
+	}
+
+	now := time.Now()
+	status, err := scrapeTarget(ctx, t, e.full)
+
+	s := &snapshot{
+		time:   now,
+		status: status,
+		err:    err,
+	}
+
+	if err != nil {
+		e.scrapeFailed(t, err)
+	} else {
+		s.derived = t.derive(now, status)
+	}
+
+	if ping != nil {
+		s.ping = <-ping
+	}
+
+	t.mu.Lock()
+	t.latest = s
+	t.mu.Unlock()
+
+	return s
+}
+
+// scrapeFailed logs and counts a failed scrape of a target.
+func (e *Exporter) scrapeFailed(t *target, err error) {
+	reason := failureReason(err)
+	e.logger.Error("failed to scrape php-fpm",
+		zap.String("target", t.Name),
+		zap.String("reason", reason),
+		zap.Error(err),
+	)
+	t.recordFailure(reason)
+}
+
+// background returns whether the target is scraped by a background loop
+// rather than on each collection.
+func (t *target) background() bool {
+	return t.ScrapeInterval > 0
+}
+
+// latestSnapshot returns the most recent scrape of the target, or nil if it
+// has not been scraped yet.
+func (t *target) latestSnapshot() *snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latest
+}
+
+// stale returns whether a snapshot is too old to be reported as up.
+func (t *target) stale(s *snapshot, now time.Time) bool {
+	maxStaleness := t.MaxStaleness
+	if maxStaleness == 0 {
+		maxStaleness = 3 * t.ScrapeInterval
+	}
+	return now.Sub(s.time) > maxStaleness
+}
+
+// RunBackground scrapes targets that have a scrape interval in the
+// background, so collections are served from the latest snapshot, and
+// follows their log files and the php-fpm error logs.
+// It blocks until the context is canceled. Run calls it, but it must be
+// called separately when using Handler or Collector directly.
+func (e *Exporter) RunBackground(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, t := range e.targets {
+		if t.background() {
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				e.scrapeLoop(ctx, t)
+			}(t)
+		}
+		if t.slowlog != nil {
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				e.tailSlowlog(ctx, t)
+			}(t)
+		}
+		if t.accessLog != nil {
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				e.tailAccessLog(ctx, t)
+			}(t)
+		}
+	}
+	for _, filename := range e.errorLogs {
+		wg.Add(1)
+		go func(filename string) {
+			defer wg.Done()
+			e.tailErrorLog(ctx, filename)
+		}(filename)
+	}
+	wg.Wait()
+	return nil
+}
+
+// scrapeJitter is the largest fraction of the interval added to or removed
+// from each wait, so targets do not all get scraped at the same moment.
+const scrapeJitter = 0.1
+
+func (e *Exporter) scrapeLoop(ctx context.Context, t *target) {
+	// scrape soon after starting, so the target is not reported down until
+	// a whole interval has passed, but not at the same moment as the others.
+	wait := time.Duration(rand.Float64() * scrapeJitter * float64(t.ScrapeInterval))
+
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		e.scrape(ctx, t)
+
+		jitter := (rand.Float64()*2 - 1) * scrapeJitter * float64(t.ScrapeInterval)
+		wait = t.ScrapeInterval + time.Duration(jitter)
+	}
+}
@@ -0,0 +1,204 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// statusServer serves jsonStatus, blocking each request until release is
+// closed, and counts the requests it receives.
+type statusServer struct {
+	*httptest.Server
+	requests *atomic.Int64
+	received chan struct{}
+	release  chan struct{}
+}
+
+func newStatusServer() *statusServer {
+	s := &statusServer{
+		requests: atomic.NewInt64(0),
+		received: make(chan struct{}, 100),
+		release:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Inc()
+		s.received <- struct{}{}
+		<-s.release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jsonStatus))
+	}))
+	return s
+}
+
+func newTestTarget(t *testing.T, rawurl string, options ...OptionsFunc) (*Exporter, *target) {
+	options = append([]OptionsFunc{
+		SetLogger(zap.NewNop()),
+		AddTarget("www", rawurl),
+	}, options...)
+	e, err := New(options...)
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	return e, e.targets[0]
+}
+
+func TestScrapeCoalesces(t *testing.T) {
+	srv := newStatusServer()
+	defer srv.Close()
+	e, target := newTestTarget(t, srv.URL+"/status")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const scrapes = 5
+	snapshots := make([]*snapshot, scrapes)
+	var wg sync.WaitGroup
+	scrape := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots[i] = e.scrape(ctx, target)
+		}()
+	}
+
+	scrape(0)
+	<-srv.received
+	for i := 1; i < scrapes; i++ {
+		scrape(i)
+	}
+	// give the other scrapes time to join the request in progress.
+	time.Sleep(100 * time.Millisecond)
+	close(srv.release)
+	wg.Wait()
+
+	if n := srv.requests.Load(); n != 1 {
+		t.Errorf("expected 1 status request, got %d", n)
+	}
+	for i, s := range snapshots {
+		if s != snapshots[0] {
+			t.Errorf("scrape %d: expected the shared snapshot, got %+v", i, s)
+		}
+	}
+	if err := snapshots[0].err; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestScrapeMinInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		minInterval time.Duration
+		requests    int64
+	}{
+		{"disabled", 0, 2},
+		{"within interval", time.Hour, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newStatusServer()
+			defer srv.Close()
+			close(srv.release)
+			e, target := newTestTarget(t, srv.URL+"/status", SetMinInterval(test.minInterval))
+
+			first := e.scrape(context.Background(), target)
+			second := e.scrape(context.Background(), target)
+
+			if n := srv.requests.Load(); n != test.requests {
+				t.Errorf("expected %d status requests, got %d", test.requests, n)
+			}
+			if reused := first == second; reused != (test.requests == 1) {
+				t.Errorf("expected the snapshot reused to be %v, got %v", !reused, reused)
+			}
+		})
+	}
+}
+
+func TestScrapeGivesUp(t *testing.T) {
+	srv := newStatusServer()
+	defer srv.Close()
+	defer close(srv.release)
+	e, target := newTestTarget(t, srv.URL+"/status")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	s := e.scrape(ctx, target)
+	if s.err == nil {
+		t.Fatal("expected an error")
+	}
+	if reason := failureReason(s.err); reason != reasonTimeout {
+		t.Errorf("expected reason timeout, got %s", reason)
+	}
+}
+
+func TestFetchContextExtend(t *testing.T) {
+	start := time.Now()
+	c := newFetchContext(start.Add(50*time.Millisecond), true)
+
+	c.extend(start.Add(300*time.Millisecond), true)
+	// an earlier deadline does not shorten the context.
+	c.extend(start.Add(10*time.Millisecond), true)
+
+	if deadline, ok := c.Deadline(); !ok || !deadline.Equal(start.Add(300*time.Millisecond)) {
+		t.Errorf("expected the extended deadline, got %v %v", deadline, ok)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected the context to be extended, got %v", err)
+	}
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to expire")
+	}
+	if err := c.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("expected the context to expire after 300ms, took %v", elapsed)
+	}
+}
+
+func TestFetchContextRemoveDeadline(t *testing.T) {
+	c := newFetchContext(time.Now().Add(20*time.Millisecond), true)
+	c.extend(time.Time{}, false)
+
+	if _, ok := c.Deadline(); ok {
+		t.Error("expected no deadline")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected the context not to expire, got %v", err)
+	}
+
+	c.cancel(context.Canceled)
+	c.cancel(context.DeadlineExceeded)
+	<-c.Done()
+	if err := c.Err(); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestFetchContextPastDeadline(t *testing.T) {
+	c := newFetchContext(time.Now().Add(-time.Second), true)
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to expire")
+	}
+	if err := c.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,162 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxWindowStacks limits how many slowlog stacks are kept per target.
+const maxWindowStacks = 10000
+
+// stackSample is a slowlog stack trace in folded form.
+type stackSample struct {
+	time   time.Time
+	folded string
+}
+
+// stackWindow keeps the slowlog stack traces of a target seen within a
+// window of time.
+type stackWindow struct {
+	window  time.Duration
+	mu      sync.Mutex
+	samples []stackSample
+}
+
+func newStackWindow(window time.Duration) *stackWindow {
+	return &stackWindow{window: window}
+}
+
+// add records the stack trace of a slowlog entry.
+func (w *stackWindow) add(now time.Time, entry *slowlogEntry) {
+	if len(entry.frames) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = append(w.samples, stackSample{
+		time:   now,
+		folded: foldStack(entry),
+	})
+	w.prune(now)
+}
+
+// prune drops samples that are too old or too many.
+func (w *stackWindow) prune(now time.Time) {
+	cutoff := now.Add(-w.window)
+	i := sort.Search(len(w.samples), func(i int) bool {
+		return w.samples[i].time.After(cutoff)
+	})
+	if over := len(w.samples) - maxWindowStacks; over > i {
+		i = over
+	}
+	if i > 0 {
+		w.samples = append(w.samples[:0], w.samples[i:]...)
+	}
+}
+
+// counts returns how often each folded stack was seen within window of now.
+func (w *stackWindow) counts(now time.Time, window time.Duration) map[string]int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.prune(now)
+	cutoff := now.Add(-window)
+	counts := map[string]int{}
+	for _, s := range w.samples {
+		if s.time.After(cutoff) {
+			counts[s.folded]++
+		}
+	}
+	return counts
+}
+
+// foldStack returns the stack trace of an entry in folded form, the script
+// followed by each function from the outermost frame in, separated by
+// semicolons.
+func foldStack(entry *slowlogEntry) string {
+	frames := make([]string, 0, len(entry.frames)+1)
+	if entry.script != "" {
+		frames = append(frames, foldedFrame(entry.script))
+	}
+	for i := len(entry.frames) - 1; i >= 0; i-- {
+		frames = append(frames, foldedFrame(entry.frames[i].function))
+	}
+	return strings.Join(frames, ";")
+}
+
+// foldedFrame removes the characters that separate frames and counts from a
+// frame name.
+func foldedFrame(name string) string {
+	return strings.NewReplacer(";", ":", "\n", " ").Replace(name)
+}
+
+// slowlogStacks serves the slowlog stack traces seen within a window in
+// folded format, or as a flamegraph.
+func (e *Exporter) slowlogStacks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := e.slowlogWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > e.slowlogWindow {
+			http.Error(w, fmt.Sprintf("window must be a duration of at most %s", e.slowlogWindow), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	format := q.Get("format")
+	if format != "" && format != "folded" && format != "svg" {
+		http.Error(w, "format must be folded or svg", http.StatusBadRequest)
+		return
+	}
+
+	// with all targets included, each stack starts with its target.
+	name := q.Get("target")
+	found := false
+	now := time.Now()
+	counts := map[string]int{}
+	for _, t := range e.targets {
+		if t.stacks == nil || (name != "" && t.Name != name) {
+			continue
+		}
+		found = true
+		for stack, n := range t.stacks.counts(now, window) {
+			if name == "" {
+				stack = foldedFrame(t.Name) + ";" + stack
+			}
+			counts[stack] += n
+		}
+	}
+	if name != "" && !found {
+		http.Error(w, "no slowlog is followed for target "+name, http.StatusNotFound)
+		return
+	}
+
+	if format == "svg" {
+		title := "php-fpm slowlog"
+		if name != "" {
+			title += " " + name
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		writeFlamegraph(w, fmt.Sprintf("%s, last %s", title, window), counts)
+		return
+	}
+
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, stack := range stacks {
+		fmt.Fprintf(w, "%s %d\n", stack, counts[stack])
+	}
+}
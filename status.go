@@ -0,0 +1,217 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// statusTimeLayout is the format php-fpm uses for times on the text status page.
+const statusTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// poolStatus is the pool summary reported by the php-fpm status page.
+type poolStatus struct {
+	Pool               string `json:"pool"`
+	ProcessManager     string `json:"process manager"`
+	StartTime          int64  `json:"start time"`
+	StartSince         int64  `json:"start since"`
+	AcceptedConn       int64  `json:"accepted conn"`
+	ListenQueue        int64  `json:"listen queue"`
+	MaxListenQueue     int64  `json:"max listen queue"`
+	ListenQueueLen     int64  `json:"listen queue len"`
+	IdleProcesses      int64  `json:"idle processes"`
+	ActiveProcesses    int64  `json:"active processes"`
+	TotalProcesses     int64  `json:"total processes"`
+	MaxActiveProcesses int64  `json:"max active processes"`
+	MaxChildrenReached int64  `json:"max children reached"`
+	SlowRequests       int64  `json:"slow requests"`
+
+	Processes []processStatus `json:"processes"`
+}
+
+// processStatus describes a single worker as listed on the full status page.
+type processStatus struct {
+	PID               int64   `json:"pid"`
+	State             string  `json:"state"`
+	StartTime         int64   `json:"start time"`
+	StartSince        int64   `json:"start since"`
+	Requests          int64   `json:"requests"`
+	RequestDuration   int64   `json:"request duration"`
+	RequestMethod     string  `json:"request method"`
+	RequestURI        string  `json:"request uri"`
+	ContentLength     int64   `json:"content length"`
+	User              string  `json:"user"`
+	Script            string  `json:"script"`
+	LastRequestCPU    float64 `json:"last request cpu"`
+	LastRequestMemory int64   `json:"last request memory"`
+}
+
+// statusQuery appends each of flags to the raw query string unless
+// it is already present.
+func statusQuery(rawQuery string, flags ...string) string {
+	present := map[string]bool{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if i := strings.Index(part, "="); i >= 0 {
+			part = part[:i]
+		}
+		present[part] = true
+	}
+
+	for _, flag := range flags {
+		if present[flag] {
+			continue
+		}
+		if rawQuery != "" {
+			rawQuery += "&"
+		}
+		rawQuery += flag
+		present[flag] = true
+	}
+
+	return rawQuery
+}
+
+// parseStatus decodes a php-fpm status page. The JSON format is preferred,
+// but pools that do not support it return the plain text page instead.
+func parseStatus(body []byte) (*poolStatus, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errEmptyStatus
+	}
+
+	if body[0] == '{' {
+		return parseStatusJSON(body)
+	}
+
+	return parseStatusText(body)
+}
+
+func parseStatusJSON(body []byte) (*poolStatus, error) {
+	var s poolStatus
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, errors.Wrap(err, "failed to decode json status")
+	}
+	return &s, nil
+}
+
+func parseStatusText(body []byte) (*poolStatus, error) {
+	var (
+		s      poolStatus
+		fields = s.textFields()
+		found  int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// each worker on the full status page starts with a line of asterisks.
+		if strings.HasPrefix(line, "*") {
+			s.Processes = append(s.Processes, processStatus{})
+			fields = s.Processes[len(s.Processes)-1].textFields()
+			continue
+		}
+
+		key, value, ok := splitStatusLine(line)
+		if !ok {
+			continue
+		}
+
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		if err := setTextField(field, key, value); err != nil {
+			return nil, err
+		}
+		found++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read text status")
+	}
+
+	if found == 0 {
+		return nil, errors.New("no status fields found")
+	}
+
+	return &s, nil
+}
+
+// textTime is a unix timestamp that is formatted as a date on the text status page.
+type textTime struct {
+	unix *int64
+}
+
+func (s *poolStatus) textFields() map[string]interface{} {
+	return map[string]interface{}{
+		"pool":                 &s.Pool,
+		"process manager":      &s.ProcessManager,
+		"start time":           textTime{&s.StartTime},
+		"start since":          &s.StartSince,
+		"accepted conn":        &s.AcceptedConn,
+		"listen queue":         &s.ListenQueue,
+		"max listen queue":     &s.MaxListenQueue,
+		"listen queue len":     &s.ListenQueueLen,
+		"idle processes":       &s.IdleProcesses,
+		"active processes":     &s.ActiveProcesses,
+		"total processes":      &s.TotalProcesses,
+		"max active processes": &s.MaxActiveProcesses,
+		"max children reached": &s.MaxChildrenReached,
+		"slow requests":        &s.SlowRequests,
+	}
+}
+
+func (p *processStatus) textFields() map[string]interface{} {
+	return map[string]interface{}{
+		"pid":                 &p.PID,
+		"state":               &p.State,
+		"start time":          textTime{&p.StartTime},
+		"start since":         &p.StartSince,
+		"requests":            &p.Requests,
+		"request duration":    &p.RequestDuration,
+		"request method":      &p.RequestMethod,
+		"request URI":         &p.RequestURI,
+		"content length":      &p.ContentLength,
+		"user":                &p.User,
+		"script":              &p.Script,
+		"last request cpu":    &p.LastRequestCPU,
+		"last request memory": &p.LastRequestMemory,
+	}
+}
+
+func setTextField(field interface{}, key string, value string) error {
+	var err error
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *int64:
+		*f, err = strconv.ParseInt(value, 10, 64)
+	case *float64:
+		*f, err = strconv.ParseFloat(value, 64)
+	case textTime:
+		var t time.Time
+		t, err = time.Parse(statusTimeLayout, value)
+		*f.unix = t.Unix()
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "invalid value for %q", key)
+	}
+	return nil
+}
+
+// splitStatusLine splits a "key: value" line from the text status page.
+func splitStatusLine(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), true
+}
@@ -0,0 +1,176 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+const textStatus = `pool:                 www
+process manager:      dynamic
+start time:           21/Jan/2019:10:11:12 +0000
+start since:          1234
+accepted conn:        56
+listen queue:         0
+max listen queue:     1
+listen queue len:     128
+idle processes:       2
+active processes:     1
+total processes:      3
+max active processes: 2
+max children reached: 4
+slow requests:        5
+`
+
+const textStatusFull = textStatus + `
+************************
+pid:                  31
+state:                Running
+start time:           21/Jan/2019:10:11:12 +0000
+start since:          1234
+requests:             19
+request duration:     194
+request method:       GET
+request URI:          /status?full
+content length:       0
+user:                 -
+script:               -
+last request cpu:     0.00
+last request memory:  0
+
+************************
+pid:                  32
+state:                Idle
+start time:           21/Jan/2019:10:11:12 +0000
+start since:          1234
+requests:             37
+request duration:     15204
+request method:       POST
+request URI:          /index.php?page=2
+content length:       512
+user:                 -
+script:               /var/www/index.php
+last request cpu:     65.77
+last request memory:  2097152
+`
+
+const jsonStatus = `{"pool":"www","process manager":"dynamic","start time":1548065472,"start since":1234,"accepted conn":56,"listen queue":0,"max listen queue":1,"listen queue len":128,"idle processes":2,"active processes":1,"total processes":3,"max active processes":2,"max children reached":4,"slow requests":5}`
+
+const jsonStatusFull = `{"pool":"www","process manager":"dynamic","start time":1548065472,"start since":1234,"accepted conn":56,"listen queue":0,"max listen queue":1,"listen queue len":128,"idle processes":2,"active processes":1,"total processes":3,"max active processes":2,"max children reached":4,"slow requests":5, "processes":[{"pid":31,"state":"Running","start time":1548065472,"start since":1234,"requests":19,"request duration":194,"request method":"GET","request uri":"/status?json&full","content length":0,"user":"-","script":"-","last request cpu":0.00,"last request memory":0},{"pid":32,"state":"Idle","start time":1548065472,"start since":1234,"requests":37,"request duration":15204,"request method":"POST","request uri":"/index.php?page=2","content length":512,"user":"-","script":"/var/www/index.php","last request cpu":65.77,"last request memory":2097152}]}`
+
+var expectedPool = poolStatus{
+	Pool:               "www",
+	ProcessManager:     "dynamic",
+	StartTime:          1548065472,
+	StartSince:         1234,
+	AcceptedConn:       56,
+	MaxListenQueue:     1,
+	ListenQueueLen:     128,
+	IdleProcesses:      2,
+	ActiveProcesses:    1,
+	TotalProcesses:     3,
+	MaxActiveProcesses: 2,
+	MaxChildrenReached: 4,
+	SlowRequests:       5,
+}
+
+func expectedProcesses(statusURI string) []processStatus {
+	return []processStatus{
+		{
+			PID:             31,
+			State:           "Running",
+			StartTime:       1548065472,
+			StartSince:      1234,
+			Requests:        19,
+			RequestDuration: 194,
+			RequestMethod:   "GET",
+			RequestURI:      statusURI,
+			User:            "-",
+			Script:          "-",
+		},
+		{
+			PID:               32,
+			State:             "Idle",
+			StartTime:         1548065472,
+			StartSince:        1234,
+			Requests:          37,
+			RequestDuration:   15204,
+			RequestMethod:     "POST",
+			RequestURI:        "/index.php?page=2",
+			ContentLength:     512,
+			User:              "-",
+			Script:            "/var/www/index.php",
+			LastRequestCPU:    65.77,
+			LastRequestMemory: 2097152,
+		},
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	full := expectedPool
+	full.Processes = expectedProcesses("/status?full")
+	jsonFull := expectedPool
+	jsonFull.Processes = expectedProcesses("/status?json&full")
+
+	tests := []struct {
+		name     string
+		body     string
+		expected poolStatus
+	}{
+		{"text", textStatus, expectedPool},
+		{"text full", textStatusFull, full},
+		{"json", jsonStatus, expectedPool},
+		{"json full", jsonStatusFull, jsonFull},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := parseStatus([]byte(test.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*s, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, *s)
+			}
+		})
+	}
+}
+
+func TestParseStatusErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty", "  \n"},
+		{"html", "<html><body>File not found.</body></html>"},
+		{"invalid json", `{"pool":`},
+		{"invalid number", "pool: www\naccepted conn: many\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseStatus([]byte(test.body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestStatusQuery(t *testing.T) {
+	tests := []struct {
+		rawQuery string
+		flags    []string
+		expected string
+	}{
+		{"", []string{"json"}, "json"},
+		{"", []string{"json", "full"}, "json&full"},
+		{"full", []string{"json", "full"}, "full&json"},
+		{"a=b", []string{"json"}, "a=b&json"},
+		{"json=1", []string{"json"}, "json=1"},
+	}
+
+	for _, test := range tests {
+		if got := statusQuery(test.rawQuery, test.flags...); got != test.expected {
+			t.Errorf("statusQuery(%q, %v): expected %q, got %q", test.rawQuery, test.flags, test.expected, got)
+		}
+	}
+}
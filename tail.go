@@ -0,0 +1,168 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tailPollInterval is how often a tailed file is checked for new lines,
+// rotation and truncation.
+const tailPollInterval = time.Second
+
+// tailer follows a log file like tail -F. It reopens the file when it is
+// rotated and starts over when it is truncated.
+type tailer struct {
+	filename string
+	logger   *zap.Logger
+	file     *os.File
+	reader   *bufio.Reader
+	offset   int64
+	// partial holds a line that has not been terminated yet.
+	partial []byte
+	// idle is called, if set, after a poll that found no new lines.
+	idle func()
+}
+
+func newTailer(filename string, logger *zap.Logger) *tailer {
+	return &tailer{
+		filename: filename,
+		logger:   logger.With(zap.String("file", filename)),
+	}
+}
+
+// run calls fn with each line appended to the file until the context is
+// canceled. Lines already in the file when run is called are skipped.
+func (t *tailer) run(ctx context.Context, fn func(line string)) {
+	defer t.close()
+
+	if err := t.open(true); err != nil && !os.IsNotExist(err) {
+		t.logger.Warn("failed to open log file", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if lines := t.poll(fn); lines == 0 && t.idle != nil {
+			t.idle()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads any new lines and handles rotation and truncation. It returns
+// the number of lines read.
+func (t *tailer) poll(fn func(line string)) int {
+	if t.file == nil {
+		// a file that appears later is read from the start.
+		if err := t.open(false); err != nil {
+			if !os.IsNotExist(err) {
+				t.logger.Warn("failed to open log file", zap.Error(err))
+			}
+			return 0
+		}
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		t.logger.Warn("failed to stat log file", zap.Error(err))
+		t.close()
+		return 0
+	}
+
+	if current.Size() < t.offset {
+		t.logger.Info("log file truncated")
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			t.logger.Warn("failed to seek log file", zap.Error(err))
+			t.close()
+			return 0
+		}
+		t.offset = 0
+		t.partial = nil
+		t.reader.Reset(t.file)
+	}
+
+	lines := t.read(fn)
+
+	// the rest of a rotated file has been read above, so the new file can
+	// be read from the start.
+	latest, err := os.Stat(t.filename)
+	if err == nil && !os.SameFile(current, latest) {
+		t.logger.Info("log file rotated")
+		t.close()
+		if err := t.open(false); err != nil {
+			t.logger.Warn("failed to open log file", zap.Error(err))
+			return lines
+		}
+		lines += t.read(fn)
+	}
+	return lines
+}
+
+// read calls fn with each complete line read from the file. It returns the
+// number of lines read.
+func (t *tailer) read(fn func(line string)) int {
+	var lines int
+	for {
+		data, err := t.reader.ReadBytes('\n')
+		t.offset += int64(len(data))
+		if err != nil {
+			t.partial = append(t.partial, data...)
+			if err != io.EOF {
+				t.logger.Warn("failed to read log file", zap.Error(err))
+			}
+			return lines
+		}
+
+		line := data[:len(data)-1]
+		if len(t.partial) > 0 {
+			line = append(t.partial, line...)
+			t.partial = nil
+		}
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		fn(string(line))
+		lines++
+	}
+}
+
+// open opens the file, positioned at the end if atEnd is set.
+func (t *tailer) open(atEnd bool) error {
+	f, err := os.Open(t.filename)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if atEnd {
+		offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	t.file = f
+	t.offset = offset
+	t.partial = nil
+	t.reader = bufio.NewReader(f)
+	return nil
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
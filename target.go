@@ -0,0 +1,207 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// target is a single php-fpm pool to scrape.
+type target struct {
+	targetConfig
+	url    *url.URL
+	client *http.Client
+	// failures counts failed scrapes by reason. The map is not modified
+	// after the target is created.
+	failures map[string]*atomic.Int64
+	// fetchDuration observes the phases of status requests.
+	fetchDuration *prometheus.HistogramVec
+	// pingDuration observes the latency of successful ping checks. It is
+	// nil if the check is not configured.
+	pingDuration prometheus.Histogram
+	// slowlog counts the entries of the slowlog. It is nil if the
+	// slowlog is not followed.
+	slowlog *slowlogMetrics
+	// stacks keeps the recent stack traces of the slowlog.
+	stacks *stackWindow
+	// accessLog observes the requests read from the access log. It is nil
+	// if the access log is not followed.
+	accessLog *accessLogMetrics
+	// inflight is the status request in progress, if any.
+	inflight *inflightFetch
+	mu       sync.Mutex
+	previous *statusSample
+	latest   *snapshot
+}
+
+// newTarget creates a target from its configuration. http and https URLs are
+// scraped over HTTP, tcp and unix URLs are scraped using fastcgi.
+func newTarget(tc targetConfig) (*target, error) {
+	if tc.Name == "" {
+		return nil, errors.New("target name is required")
+	}
+
+	u, err := url.Parse(tc.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse url")
+	}
+
+	switch u.Scheme {
+	case "http", "https", "tcp", "unix":
+	default:
+		return nil, errors.Errorf("unsupported scheme %q for target %s", u.Scheme, tc.Name)
+	}
+
+	if tc.PidFile != "" && tc.Pid != 0 {
+		return nil, errors.New("at most one of pid and pid_file may be set")
+	}
+
+	failures := make(map[string]*atomic.Int64, len(failureReasons))
+	for _, reason := range failureReasons {
+		failures[reason] = atomic.NewInt64(0)
+	}
+
+	return &target{
+		targetConfig: tc,
+		url:          u,
+		failures:     failures,
+	}, nil
+}
+
+// addTarget creates a target and adds it to the exporter.
+func (e *Exporter) addTarget(tc targetConfig) error {
+	for _, t := range e.targets {
+		if t.Name == tc.Name {
+			return errors.Errorf("duplicate target %s", tc.Name)
+		}
+	}
+
+	t, err := newTarget(tc)
+	if err != nil {
+		return errors.Wrapf(err, "invalid target %s", tc.Name)
+	}
+
+	e.targets = append(e.targets, t)
+	return nil
+}
+
+// prepareTarget fills in the exporter wide defaults for any settings
+// the target does not set.
+func (e *Exporter) prepareTarget(t *target) error {
+	if t.DialTimeout == 0 {
+		t.DialTimeout = e.dialTimeout
+	}
+	if t.ReadTimeout == 0 {
+		t.ReadTimeout = e.readTimeout
+	}
+	if t.ScrapeTimeout == 0 {
+		t.ScrapeTimeout = e.scrapeTimeout
+	}
+	if t.ScrapeInterval == 0 {
+		t.ScrapeInterval = e.scrapeInterval
+	}
+	if t.MaxStaleness == 0 {
+		t.MaxStaleness = e.maxStaleness
+	}
+	if t.MinInterval == 0 {
+		t.MinInterval = e.minInterval
+	}
+
+	client, err := newHTTPClient(&t.HTTP, t.DialTimeout, t.ReadTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "invalid http settings for target %s", t.Name)
+	}
+	t.client = client
+	t.fetchDuration = newFetchHistogram(t.Name)
+
+	if t.Ping.Path != "" {
+		t.pingDuration = newPingHistogram(t.Name)
+	}
+	if t.Slowlog != "" {
+		t.slowlog = newSlowlogMetrics(t.Name,
+			e.newPathLabelLimiter(t.Name, "slowlog", "script"),
+			e.newLabelLimiter(t.Name, "slowlog", "function"),
+		)
+		t.stacks = newStackWindow(e.slowlogWindow)
+	}
+	if t.AccessLog.Path != "" {
+		accessLog, err := newAccessLogMetrics(t.Name, t.AccessLog,
+			e.newLabelLimiter(t.Name, "access_log", "method"),
+			e.newPathLabelLimiter(t.Name, "access_log", "script"),
+		)
+		if err != nil {
+			return errors.Wrapf(err, "invalid access log settings for target %s", t.Name)
+		}
+		t.accessLog = accessLog
+	}
+
+	return nil
+}
+
+// fastcgi returns whether the target is scraped using fastcgi rather than HTTP.
+func (t *target) fastcgi() bool {
+	return t.url.Scheme == "tcp" || t.url.Scheme == "unix"
+}
+
+// recordFailure counts a failed scrape of the target.
+func (t *target) recordFailure(reason string) {
+	if n, ok := t.failures[reason]; ok {
+		n.Inc()
+	}
+}
+
+// failureCounts returns the number of failed scrapes by reason.
+func (t *target) failureCounts() map[string]int64 {
+	counts := make(map[string]int64, len(t.failures))
+	for reason, n := range t.failures {
+		counts[reason] = n.Load()
+	}
+	return counts
+}
+
+// processes returns whether the resources used by the target's processes
+// are read from procfs.
+func (t *target) processes() bool {
+	return t.PidFile != "" || t.Pid != 0
+}
+
+// timeout returns how long a scrape of the target may take. limit is the
+// time remaining for the whole scrape, if known.
+func (t *target) timeout(limit time.Duration) time.Duration {
+	if limit > 0 && (t.ScrapeTimeout == 0 || limit < t.ScrapeTimeout) {
+		return limit
+	}
+	return t.ScrapeTimeout
+}
+
+// scrapeContext returns a context limited by the target's scrape timeout, or
+// by limit if that is shorter.
+func (t *target) scrapeContext(ctx context.Context, limit time.Duration) (context.Context, context.CancelFunc) {
+	if timeout := t.timeout(limit); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// splitUnixPath splits the path of a unix URL into the socket path and the
+// status path, so unix:///run/php/www.sock/status connects to
+// /run/php/www.sock and requests /status. The longest leading part of the
+// path that is a socket is used. If no socket is found, the whole path is
+// treated as the socket path.
+func splitUnixPath(p string) (string, string) {
+	for i := len(p); i > 0; i = strings.LastIndex(p[:i], "/") {
+		fi, err := os.Stat(p[:i])
+		if err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return p[:i], p[i:]
+		}
+	}
+	return p, ""
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"net/http/httptrace"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Phases of a status request. These are the values of the phase label on
+// phpfpm_status_fetch_duration_seconds.
+const (
+	// phaseDial is the time taken to connect. A slow connect usually means
+	// the listen backlog is full.
+	phaseDial = "dial"
+	// phaseFirstByte is the time from starting the request until the
+	// response headers arrive. It grows when every worker is busy.
+	phaseFirstByte = "first_byte"
+	// phaseTotal is the time from starting the request until the whole
+	// status page was read.
+	phaseTotal = "total"
+)
+
+// newFetchHistogram creates the histogram of status request phases for a
+// target.
+func newFetchHistogram(target string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "phpfpm",
+		Name:        "status_fetch_duration_seconds",
+		Help:        "Duration of the phases of status page requests, observed as each phase completes",
+		Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 16),
+		ConstLabels: prometheus.Labels{"target": target},
+	}, []string{"phase"})
+
+	for _, phase := range []string{phaseDial, phaseFirstByte, phaseTotal} {
+		h.WithLabelValues(phase)
+	}
+
+	return h
+}
+
+// fetchTrace times the phases of a single status request. A nil trace
+// records nothing.
+type fetchTrace struct {
+	durations    *prometheus.HistogramVec
+	start        time.Time
+	connectStart time.Time
+}
+
+// newFetchTrace starts timing a status request of the target.
+func (t *target) newFetchTrace() *fetchTrace {
+	return &fetchTrace{
+		durations: t.fetchDuration,
+		start:     time.Now(),
+	}
+}
+
+func (tr *fetchTrace) observe(phase string, since time.Time) {
+	tr.durations.WithLabelValues(phase).Observe(time.Since(since).Seconds())
+}
+
+// dialStarted is called before connecting.
+func (tr *fetchTrace) dialStarted() {
+	if tr == nil {
+		return
+	}
+	tr.connectStart = time.Now()
+}
+
+// dialed is called once connected.
+func (tr *fetchTrace) dialed() {
+	if tr == nil || tr.connectStart.IsZero() {
+		return
+	}
+	tr.observe(phaseDial, tr.connectStart)
+}
+
+// firstByte is called once the response headers arrive.
+func (tr *fetchTrace) firstByte() {
+	if tr == nil {
+		return
+	}
+	tr.observe(phaseFirstByte, tr.start)
+}
+
+// done is called once the whole response was read.
+func (tr *fetchTrace) done() {
+	if tr == nil {
+		return
+	}
+	tr.observe(phaseTotal, tr.start)
+}
+
+// clientTrace returns hooks to time an HTTP request. Reused connections
+// are not dialed, so only new connections are timed.
+func (tr *fetchTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			tr.dialStarted()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				tr.dialed()
+			}
+		},
+		GotFirstResponseByte: tr.firstByte,
+	}
+}
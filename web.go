@@ -0,0 +1,295 @@
+package exporter
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// webConfig is the format of the web configuration file. It follows the
+// format used by the Prometheus exporter-toolkit.
+type webConfig struct {
+	TLSConfig tlsServerConfig `yaml:"tls_server_config"`
+	// Users maps user names to bcrypt hashed passwords.
+	Users map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	MinVersion     string `yaml:"min_version"`
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+func loadWebConfig(filename string) (*webConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read web config file")
+	}
+
+	var c webConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse web config file %s", filename)
+	}
+
+	for user, hash := range c.Users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, errors.Wrapf(err, "invalid password hash for user %s", user)
+		}
+	}
+
+	return &c, nil
+}
+
+// SetWebConfigFile creates a function that will load TLS and basic auth
+// settings for the http server from a file.
+// Generally only used when create a new Exporter.
+func SetWebConfigFile(filename string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if filename == "" {
+			return nil
+		}
+
+		c, err := loadWebConfig(filename)
+		if err != nil {
+			return err
+		}
+		e.webConfig = c
+		return nil
+	}
+}
+
+// tlsEnabled returns whether the server should use TLS.
+func (c *webConfig) tlsEnabled() bool {
+	return c != nil && (c.TLSConfig.CertFile != "" || c.TLSConfig.KeyFile != "")
+}
+
+// newTLSConfig creates the server TLS configuration. The certificate, key
+// and client CA files are checked on each handshake and reloaded when they
+// change on disk.
+func newTLSConfig(c *tlsServerConfig) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("both cert_file and key_file are required for TLS")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, errors.Errorf("unknown min_version %q", c.MinVersion)
+		}
+		minVersion = v
+	}
+
+	clientAuth := tls.NoClientCert
+	if c.ClientCAFile != "" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.ClientAuthType != "" {
+		v, ok := clientAuthTypes[c.ClientAuthType]
+		if !ok {
+			return nil, errors.Errorf("unknown client_auth_type %q", c.ClientAuthType)
+		}
+		clientAuth = v
+	}
+
+	if clientAuth >= tls.VerifyClientCertIfGiven && c.ClientCAFile == "" {
+		return nil, errors.Errorf("client_ca_file is required for client_auth_type %s", c.ClientAuthType)
+	}
+
+	r := &tlsReloader{
+		config:     c,
+		minVersion: minVersion,
+		clientAuth: clientAuth,
+	}
+
+	// load once up front so a bad configuration is reported at startup.
+	if _, err := r.getConfig(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		// ListenAndServeTLS without certificate files requires
+		// GetCertificate, so it is backed by the reloader as well.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			config, err := r.getConfig()
+			if err != nil {
+				return nil, err
+			}
+			return &config.Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.getConfig()
+		},
+	}, nil
+}
+
+// tlsReloader reloads TLS files when their modification time changes.
+type tlsReloader struct {
+	config     *tlsServerConfig
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+
+	mu      sync.Mutex
+	modTime time.Time
+	current *tls.Config
+}
+
+func (r *tlsReloader) getConfig() (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := latestModTime(r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile)
+	if err != nil {
+		if r.current != nil {
+			// keep serving with the last good files, for example while
+			// they are being replaced.
+			return r.current, nil
+		}
+		return nil, err
+	}
+
+	if r.current != nil && modTime.Equal(r.modTime) {
+		return r.current, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		if r.current != nil {
+			return r.current, nil
+		}
+		return nil, errors.Wrap(err, "failed to load certificate")
+	}
+
+	config := &tls.Config{
+		MinVersion:   r.minVersion,
+		ClientAuth:   r.clientAuth,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.config.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			if r.current != nil {
+				return r.current, nil
+			}
+			return nil, errors.Wrap(err, "failed to read client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			if r.current != nil {
+				return r.current, nil
+			}
+			return nil, errors.Errorf("no certificates found in %s", r.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	r.current = config
+	r.modTime = modTime
+	return config, nil
+}
+
+// latestModTime returns the most recent modification time of the files.
+// Empty file names are ignored.
+func latestModTime(filenames ...string) (time.Time, error) {
+	var latest time.Time
+	for _, filename := range filenames {
+		if filename == "" {
+			continue
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to stat TLS file")
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// unknownUserHash is compared against when the user does not exist.
+const unknownUserHash = "$2a$10$g6sfizphw/OZeRAGBPDkMeOwCjtLfOij33/g4pVvZPij.kD8UxYo."
+
+// basicAuth requires requests to the handler to use one of the configured
+// users. Successful logins are cached, as checking bcrypt hashes is slow.
+type basicAuth struct {
+	users   map[string]string
+	handler http.Handler
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]bool
+}
+
+func newBasicAuth(users map[string]string, handler http.Handler) *basicAuth {
+	return &basicAuth{
+		users:   users,
+		handler: handler,
+		cache:   map[[sha256.Size]byte]bool{},
+	}
+}
+
+func (b *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if ok && b.check(user, password) {
+		b.handler.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="php-fpm exporter"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func (b *basicAuth) check(user string, password string) bool {
+	hash, ok := b.users[user]
+	if !ok {
+		// compare anyway so unknown users take as long as known ones.
+		hash = unknownUserHash
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hash))
+
+	b.mu.Lock()
+	cached := b.cache[key]
+	b.mu.Unlock()
+	if cached {
+		return true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !ok {
+		return false
+	}
+
+	b.mu.Lock()
+	b.cache[key] = true
+	b.mu.Unlock()
+
+	return true
+}
@@ -0,0 +1,320 @@
+package exporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCert writes a self signed certificate for 127.0.0.1 and its key to
+// dir, as name.crt and name.key, and returns the certificate.
+func writeCert(t *testing.T, dir string, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		name + ".crt": {Type: "CERTIFICATE", Bytes: der},
+		name + ".key": {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for filename, block := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "php-fpm-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "server")
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.crt"), []byte("no certificates\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert := filepath.Join(dir, "server.crt")
+	key := filepath.Join(dir, "server.key")
+
+	tests := []struct {
+		name   string
+		config tlsServerConfig
+	}{
+		{"missing key", tlsServerConfig{CertFile: cert}},
+		{"missing key file", tlsServerConfig{CertFile: cert, KeyFile: filepath.Join(dir, "missing.key")}},
+		{"unknown min version", tlsServerConfig{CertFile: cert, KeyFile: key, MinVersion: "TLS14"}},
+		{"unknown client auth type", tlsServerConfig{CertFile: cert, KeyFile: key, ClientAuthType: "Always"}},
+		{"verify without CA", tlsServerConfig{CertFile: cert, KeyFile: key, ClientAuthType: "RequireAndVerifyClientCert"}},
+		{"verify if given without CA", tlsServerConfig{CertFile: cert, KeyFile: key, ClientAuthType: "VerifyClientCertIfGiven"}},
+		{"CA without certificates", tlsServerConfig{CertFile: cert, KeyFile: key, ClientCAFile: filepath.Join(dir, "empty.crt")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newTLSConfig(&test.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigClientAuth(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "server")
+	writeCert(t, dir, "client")
+
+	cert := filepath.Join(dir, "server.crt")
+	key := filepath.Join(dir, "server.key")
+	ca := filepath.Join(dir, "client.crt")
+
+	tests := []struct {
+		name       string
+		config     tlsServerConfig
+		clientAuth tls.ClientAuthType
+		clientCAs  bool
+	}{
+		{"no client certificates", tlsServerConfig{CertFile: cert, KeyFile: key}, tls.NoClientCert, false},
+		{"CA requires verified certificates", tlsServerConfig{CertFile: cert, KeyFile: key, ClientCAFile: ca}, tls.RequireAndVerifyClientCert, true},
+		{"explicit type", tlsServerConfig{CertFile: cert, KeyFile: key, ClientCAFile: ca, ClientAuthType: "VerifyClientCertIfGiven"}, tls.VerifyClientCertIfGiven, true},
+		{"request without CA", tlsServerConfig{CertFile: cert, KeyFile: key, ClientAuthType: "RequestClientCert"}, tls.RequestClientCert, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(&test.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			config, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.ClientAuth != test.clientAuth {
+				t.Errorf("expected client auth %v, got %v", test.clientAuth, config.ClientAuth)
+			}
+			if (config.ClientCAs != nil) != test.clientCAs {
+				t.Errorf("expected client CAs %v, got %v", test.clientCAs, config.ClientCAs != nil)
+			}
+			if config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("expected TLS 1.2 as the minimum version, got %x", config.MinVersion)
+			}
+		})
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	first := writeCert(t, dir, "server")
+
+	config := &tlsServerConfig{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+	}
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectCert := func(expected *x509.Certificate) {
+		t.Helper()
+		cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !leaf.Equal(expected) {
+			t.Errorf("expected certificate %d, got %d", expected.SerialNumber, leaf.SerialNumber)
+		}
+	}
+
+	expectCert(first)
+
+	second := writeCert(t, dir, "server")
+	// make sure the change is seen on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	for _, filename := range []string{config.CertFile, config.KeyFile} {
+		if err := os.Chtimes(filename, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectCert(second)
+
+	// the last good certificate is kept while the files are missing.
+	if err := os.Remove(config.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	expectCert(second)
+}
+
+func TestTLSServer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	serverCert := writeCert(t, dir, "server")
+	writeCert(t, dir, "client")
+
+	tlsConfig, err := newTLSConfig(&tlsServerConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "client.crt"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: tlsConfig,
+		// rejected handshakes are expected.
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go srv.ServeTLS(l, "", "")
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		ok           bool
+	}{
+		{"client certificate", []tls.Certificate{clientCert}, true},
+		{"no client certificate", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						RootCAs:      roots,
+						Certificates: test.certificates,
+					},
+				},
+			}
+			defer client.CloseIdleConnections()
+
+			resp, err := client.Get("https://" + l.Addr().String() + "/")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != test.ok {
+				t.Errorf("expected success %v, got %v", test.ok, err)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newBasicAuth(map[string]string{"alice": string(hash)},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		noAuth   bool
+		code     int
+		cached   int
+	}{
+		{"no credentials", "", "", true, http.StatusUnauthorized, 0},
+		{"wrong password", "alice", "guess", false, http.StatusUnauthorized, 0},
+		{"unknown user", "bob", "secret", false, http.StatusUnauthorized, 0},
+		{"valid", "alice", "secret", false, http.StatusOK, 1},
+		{"cached", "alice", "secret", false, http.StatusOK, 1},
+		{"wrong password after login", "alice", "secret2", false, http.StatusUnauthorized, 1},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if !test.noAuth {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", test.name)
+		}
+		if len(auth.cache) != test.cached {
+			t.Errorf("%s: expected %d cached logins, got %d", test.name, test.cached, len(auth.cache))
+		}
+	}
+}
+
+func TestUnknownUserHash(t *testing.T) {
+	if _, err := bcrypt.Cost([]byte(unknownUserHash)); err != nil {
+		t.Errorf("unknownUserHash is not a bcrypt hash: %v", err)
+	}
+}